@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"testing"
+	"testing/iotest"
 
 	"github.com/sina-ghaderi/rabaead"
 )
@@ -389,7 +390,6 @@ func TestStreamIOErr(t *testing.T) {
 	}
 }
 
-
 func TestShortData(t *testing.T) {
 	buf := &bytes.Buffer{}
 	buf.Write(ptx[:15])
@@ -412,3 +412,264 @@ func TestShortData(t *testing.T) {
 
 }
 
+// TestStreamIOLarge large data must be opened through block reads and small underlying reads
+func TestStreamIOLarge(t *testing.T) {
+	plain := bytes.Repeat(ptx, 0x2001)
+	buf := &bytes.Buffer{}
+	w, err := rabaead.NewStreamWriter(buf, key, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"full":    func(r io.Reader) io.Reader { return r },
+		"half":    iotest.HalfReader,
+		"byte":    iotest.OneByteReader,
+		"dataerr": iotest.DataErrReader,
+	}
+
+	for name, wrap := range readers {
+		r, err := rabaead.NewStreamReader(wrap(bytes.NewReader(buf.Bytes())), key, iv, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bf, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s reader: %v", name, err)
+		}
+		if !bytes.Equal(bf, plain) {
+			t.Fatalf("%s reader: decrypted data is not same as plaintext", name)
+		}
+	}
+
+	tampered := append([]byte{}, buf.Bytes()...)
+	tampered[len(tampered)/2] ^= 0x01
+	r, err := rabaead.NewStreamReader(bytes.NewReader(tampered), key, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+}
+
+func BenchmarkStreamReader(b *testing.B) {
+	plain := make([]byte, 1<<20)
+	buf := &bytes.Buffer{}
+	w, _ := rabaead.NewStreamWriter(buf, key, iv, nil)
+	w.Write(plain)
+	w.Close()
+
+	b.SetBytes(int64(len(plain)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, _ := rabaead.NewStreamReader(bytes.NewReader(buf.Bytes()), key, iv, nil)
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestCopyIO io.Copy must use ReaderFrom and WriterTo of stream and chunk types
+func TestCopyIO(t *testing.T) {
+	plain := bytes.Repeat(ptx, 0x401)
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sbuf, cbuf := &bytes.Buffer{}, &bytes.Buffer{}
+	sw, _ := rabaead.NewStreamWriter(sbuf, key, iv, nil)
+	cw, _ := rabaead.NewChunkWriter(cbuf, 0x100, aead, iv, nil)
+	for _, w := range []io.WriteCloser{sw, cw} {
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Fatal("writer must implement io.ReaderFrom")
+		}
+		n, err := io.Copy(w, bytes.NewReader(plain))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(plain)) {
+			t.Fatal("wrong copied len")
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sr, _ := rabaead.NewStreamReader(sbuf, key, iv, nil)
+	cr, _ := rabaead.NewChunkReader(cbuf, 0x100, aead, iv, nil)
+	for _, r := range []io.Reader{sr, cr} {
+		if _, ok := r.(io.WriterTo); !ok {
+			t.Fatal("reader must implement io.WriterTo")
+		}
+		dst := &bytes.Buffer{}
+		if _, err := io.Copy(dst, r); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dst.Bytes(), plain) {
+			t.Fatal("decrypted data is not same as plaintext")
+		}
+	}
+
+	sbuf.Reset()
+	sw, _ = rabaead.NewStreamWriter(sbuf, key, iv, nil)
+	io.Copy(sw, bytes.NewReader(plain))
+	sw.Close()
+	sbuf.Bytes()[0] ^= 0x01
+	sr, _ = rabaead.NewStreamReader(sbuf, key, iv, nil)
+	if _, err := io.Copy(io.Discard, sr); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+}
+
+// TestChunkReadFrom short reads of src must be collected in full chunks
+func TestChunkReadFrom(t *testing.T) {
+	plain := bytes.Repeat(ptx, 0x401)
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	w, _ := rabaead.NewChunkWriter(buf, 0x100, aead, iv, nil)
+	if _, err := w.ReadFrom(iotest.OneByteReader(bytes.NewReader(plain))); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := (len(plain) + 0xff) / 0x100
+	if buf.Len() != chunks*(2+0x100+aead.Overhead()) {
+		t.Fatalf("one byte reads are sealed in %d bytes, want %d full chunks", buf.Len(), chunks)
+	}
+
+	r, _ := rabaead.NewChunkReader(buf, 0x100, aead, iv, nil)
+	bf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bf, plain) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+}
+
+func benchmarkSeal(b *testing.B, size int) {
+	aead, _ := rabaead.NewAEAD(key)
+	plain := make([]byte, size)
+	out := make([]byte, 0, size+aead.Overhead())
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		aead.Seal(out[:0], iv, plain, nil)
+	}
+}
+
+func benchmarkOpen(b *testing.B, size int) {
+	aead, _ := rabaead.NewAEAD(key)
+	sealed := aead.Seal(nil, iv, make([]byte, size), nil)
+	out := make([]byte, 0, size)
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := aead.Open(out[:0], iv, sealed, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSeal64(b *testing.B) { benchmarkSeal(b, 64) }
+func BenchmarkSeal1K(b *testing.B) { benchmarkSeal(b, 1024) }
+func BenchmarkOpen64(b *testing.B) { benchmarkOpen(b, 64) }
+func BenchmarkOpen1K(b *testing.B) { benchmarkOpen(b, 1024) }
+
+// TestSealCompat Seal output must be same as streamWriter, which is built on rabbitio
+func TestSealCompat(t *testing.T) {
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ad := []byte{0x01, 0x01, 0x01, 0x01}
+	plain := bytes.Repeat(ptx, 8)
+	for _, nonce := range [][]byte{iv, {}} {
+		for i := 0; i <= len(plain); i++ {
+			buf := &bytes.Buffer{}
+			w, _ := rabaead.NewStreamWriter(buf, key, nonce, func() []byte { return ad })
+			w.Write(plain[:i])
+			w.Close()
+
+			if !bytes.Equal(aead.Seal(nil, nonce, plain[:i], ad), buf.Bytes()) {
+				t.Fatalf("sealed data of len %d is not same as streamWriter", i)
+			}
+		}
+	}
+}
+
+// TestChunkCounter reordered, truncated and extended
+// streams must be rejected in counter mode
+func TestChunkCounter(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csize := 0x08
+	chunk := 2 + csize + aead.Overhead()
+	plain := bytes.Repeat(ptx[:csize], 3)
+
+	buf := &bytes.Buffer{}
+	w, _ := rabaead.NewChunkWriter(buf, csize, aead, iv, nil)
+	w.SetCounter(true)
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	enc := buf.Bytes()
+	t.Logf("aead encrypted: %x\n", enc)
+	if len(enc) != 4*chunk {
+		t.Fatal("wrong stream len, final chunk is missing")
+	}
+	if bytes.Equal(enc[:chunk-16], enc[chunk:2*chunk-16]) {
+		t.Fatal("chunks of same plaintext must not share keystream")
+	}
+
+	open := func(b []byte) ([]byte, error) {
+		r, _ := rabaead.NewChunkReader(bytes.NewReader(b), csize, aead, iv, nil)
+		r.SetCounter(true)
+		return io.ReadAll(r)
+	}
+
+	bf, err := open(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bf, plain) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+
+	swapped := append(append(append([]byte{}, enc[chunk:2*chunk]...), enc[:chunk]...), enc[2*chunk:]...)
+	if _, err := open(swapped); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for reordered chunks")
+	}
+
+	if _, err := open(enc[:3*chunk]); err != io.ErrUnexpectedEOF {
+		t.Fatal("err unexpected EOF must returned for truncated stream")
+	}
+
+	if _, err := open(append(append([]byte{}, enc...), enc[3*chunk:]...)); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for data after final chunk")
+	}
+}
@@ -0,0 +1,70 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// nopAEAD is a no-op aead with 16 byte zero tag, to measure io allocations only
+type nopAEAD struct{}
+
+func (nopAEAD) NonceSize() int { return 8 }
+func (nopAEAD) Overhead() int  { return 16 }
+
+func (nopAEAD) Seal(dst, nonce, plaintext, ad []byte) []byte {
+	dst = append(dst, plaintext...)
+	return append(dst, make([]byte, 16)...)
+}
+
+func (nopAEAD) Open(dst, nonce, ciphertext, ad []byte) ([]byte, error) {
+	return append(dst, ciphertext[:len(ciphertext)-16]...), nil
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+// loopReader returns the same sealed data over and over
+type loopReader struct{ r *bytes.Reader }
+
+func (l loopReader) Read(b []byte) (int, error) {
+	n, err := l.r.Read(b)
+	if err == io.EOF {
+		l.r.Seek(0, io.SeekStart)
+		return l.r.Read(b)
+	}
+	return n, err
+}
+
+func TestChunkIOAllocs(t *testing.T) {
+	w, _ := rabaead.NewChunkWriter(nopWriter{}, 0x08, nopAEAD{}, iv, nil)
+	if a := testing.AllocsPerRun(100, func() { w.Write(ptx) }); a != 0 {
+		t.Fatalf("chunkWriter allocates %v times per write", a)
+	}
+
+	buf := &bytes.Buffer{}
+	cw, _ := rabaead.NewChunkWriter(buf, 0x08, nopAEAD{}, iv, nil)
+	cw.Write(ptx)
+
+	r, _ := rabaead.NewChunkReader(loopReader{bytes.NewReader(buf.Bytes())}, 0x08, nopAEAD{}, iv, nil)
+	pbf := make([]byte, len(ptx))
+	if a := testing.AllocsPerRun(100, func() { r.Read(pbf) }); a != 0 {
+		t.Fatalf("chunkReader allocates %v times per read", a)
+	}
+}
+
+func TestStreamReaderAllocs(t *testing.T) {
+	r, err := rabaead.NewStreamReader(loopReader{bytes.NewReader(ptx)}, key, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pbf := make([]byte, 64)
+	r.Read(pbf)
+	if a := testing.AllocsPerRun(100, func() { r.Read(pbf) }); a != 0 {
+		t.Fatalf("streamReader allocates %v times per read", a)
+	}
+}
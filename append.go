@@ -0,0 +1,69 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+)
+
+var (
+	ErrAppend       = errors.New("rabaead: chunk file is truncated or not finalized")
+	ErrAppendMerkle = errors.New("rabaead: merkle mode chunk file can not be appended")
+)
+
+// OpenAppend returns chunkWriter in counter mode which appends to chunk file f, written
+// by a chunkWriter in counter mode with the same chunk size, aead, nonce and AdFunc.
+// every chunk of f is opened from the start, so appending costs a full read of f, then
+// writing continues with next chunk index over the final chunk. partial chunk is never
+// sealed again, since that would reuse its nonce. f is valid until the first Write,
+// after that it is valid again only after Close writes the new final chunk. empty f is
+// a new file. merkle mode files are rejected with ErrAppendMerkle, since the tree after
+// the final chunk can not be extended in place
+func OpenAppend(f io.ReadWriteSeeker, chnk int, a cipher.AEAD, nonce []byte, adfunc AdditionalFunc) (*chunkWriter, error) {
+	w, err := NewChunkWriter(f, chnk, a, nonce, adfunc)
+	if err != nil {
+		return nil, err
+	}
+	w.SetCounter(true)
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return w, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	r, err := NewChunkReader(f, chnk, a, nonce, adfunc)
+	if err != nil {
+		return nil, err
+	}
+	r.SetCounter(true)
+	for !r.final {
+		if _, err := r.read(); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil, ErrAppend
+			}
+			return nil, err
+		}
+	}
+
+	// final chunk of merkle mode carries the trailer, plain final chunk is empty
+	if r.clen == merkleTrailer {
+		return nil, ErrAppendMerkle
+	}
+	sealed := int64(len(w.chnk))
+	if int64(r.index)*sealed != size {
+		return nil, ErrAppend
+	}
+
+	// next chunk overwrites final chunk
+	if _, err := f.Seek(size-sealed, io.SeekStart); err != nil {
+		return nil, err
+	}
+	w.chunks = int(r.index - 1)
+	return w, nil
+}
@@ -0,0 +1,106 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestOpenAppend(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "rolling.dat")
+	appendFile := func(b []byte) error {
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := rabaead.OpenAppend(f, 0x08, aead, iv, nil)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		return w.Close()
+	}
+
+	for _, p := range [][]byte{ptx[:10], ptx[10:11], {}, ptx[11:]} {
+		if err := appendFile(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	enc, _ := os.ReadFile(name)
+	r, _ := rabaead.NewChunkReader(bytes.NewReader(enc), 0x08, aead, iv, nil)
+	r.SetCounter(true)
+	bf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bf, ptx) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+
+	chunk := 2 + 0x08 + aead.Overhead()
+	os.WriteFile(name, enc[:len(enc)-chunk], 0600)
+	if err := appendFile(ptx); err != rabaead.ErrAppend {
+		t.Fatal("err append must returned for file without final chunk")
+	}
+
+	enc[len(enc)-chunk-3] ^= 0x01
+	os.WriteFile(name, enc, 0600)
+	if err := appendFile(ptx); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+
+	// first chunk is verified too, not only the tail
+	enc[len(enc)-chunk-3] ^= 0x01
+	enc[3] ^= 0x01
+	os.WriteFile(name, enc, 0600)
+	if err := appendFile(ptx); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for tampered first chunk")
+	}
+}
+
+func TestOpenAppendMerkle(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := rabaead.NewChunkWriter(buf, 0x40, aead, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetMerkle(true)
+	if _, err := w.Write(bytes.Repeat(ptx, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(t.TempDir(), "merkle.dat")
+	os.WriteFile(name, buf.Bytes(), 0600)
+	f, err := os.OpenFile(name, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := rabaead.OpenAppend(f, 0x40, aead, iv, nil); err != rabaead.ErrAppendMerkle {
+		t.Fatal("err append merkle must returned")
+	}
+	if b, _ := os.ReadFile(name); !bytes.Equal(b, buf.Bytes()) {
+		t.Fatal("merkle file must not be modified")
+	}
+}
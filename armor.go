@@ -0,0 +1,216 @@
+package rabaead
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+// armored message: header line || base64 lines of 64 chars || "=" base64 of crc32 (ieee,
+// big endian) of binary data || footer line. checksum only detects damage from copy
+// and paste, authenticity is still provided by the sealed message itself
+const (
+	ArmorHeader = "-----BEGIN RABAEAD MESSAGE-----"
+	ArmorFooter = "-----END RABAEAD MESSAGE-----"
+	armorLine   = 48 // binary bytes per line, 64 base64 chars
+)
+
+var ErrArmor = errors.New("rabaead: malformed armored message or checksum mismatch")
+
+type armorWriter struct {
+	writer io.Writer
+	crc    hash.Hash32
+	buff   []byte // binary data of current line
+	line   []byte // encoded line
+	head   bool
+	closed bool
+}
+
+type armorReader struct {
+	reader *bufio.Reader
+	crc    hash.Hash32
+	rest   string // base64 chars not yet decoded, less than 4
+	buff   []byte
+	final  error
+}
+
+// NewArmorWriter returns armorWriter data type, written binary data, like output of
+// a streamWriter or chunkWriter, is armored into w. Close must be called to write
+// the checksum and footer, it runs Close method of w if there is any
+func NewArmorWriter(w io.Writer) *armorWriter {
+	return &armorWriter{
+		writer: w,
+		crc:    crc32.NewIEEE(),
+		buff:   make([]byte, 0, armorLine),
+		line:   make([]byte, base64.StdEncoding.EncodedLen(armorLine)+1),
+	}
+}
+
+// NewArmorReader reads header line of armored message r and returns armorReader data
+// type, which reads binary data. leading blank lines and spaces are skipped, base64
+// lines may be wrapped at any width. ErrArmor is returned if checksum or footer is
+// wrong, io.ErrUnexpectedEOF if r ends before them
+func NewArmorReader(r io.Reader) (*armorReader, error) {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == ArmorHeader {
+			break
+		}
+		if line != "" || err != nil {
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, ErrArmor
+		}
+	}
+	return &armorReader{reader: br, crc: crc32.NewIEEE()}, nil
+}
+
+// Write armors b, complete lines are written to underlying writer
+func (w *armorWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("rabaead: write to closed armor writer")
+	}
+	if err := w.header(); err != nil {
+		return 0, err
+	}
+
+	var n int
+	for len(b) > 0 {
+		c := copy(w.buff[len(w.buff):armorLine], b)
+		w.buff = w.buff[:len(w.buff)+c]
+		b = b[c:]
+		n += c
+
+		if len(w.buff) == armorLine {
+			if err := w.flushLine(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Close writes last line, checksum and footer, then runs Close method of underlying
+// writer, if there is any
+func (w *armorWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.header(); err != nil {
+		return err
+	}
+	if len(w.buff) > 0 {
+		if err := w.flushLine(); err != nil {
+			return err
+		}
+	}
+	w.closed = true
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], w.crc.Sum32())
+	tail := "=" + base64.StdEncoding.EncodeToString(sum[:]) + "\n" + ArmorFooter + "\n"
+	if _, err := io.WriteString(w.writer, tail); err != nil {
+		return err
+	}
+
+	if c, ok := w.writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (w *armorWriter) header() error {
+	if w.head {
+		return nil
+	}
+	w.head = true
+	_, err := io.WriteString(w.writer, ArmorHeader+"\n")
+	return err
+}
+
+func (w *armorWriter) flushLine() error {
+	w.crc.Write(w.buff)
+	n := base64.StdEncoding.EncodedLen(len(w.buff))
+	base64.StdEncoding.Encode(w.line, w.buff)
+	w.line[n] = '\n'
+	w.buff = w.buff[:0]
+	_, err := writeFull(w.writer, w.line[:n+1])
+	return err
+}
+
+// Read reads binary data of armored message, io.EOF is returned only after checksum
+// and footer are verified
+func (r *armorReader) Read(b []byte) (int, error) {
+	for len(r.buff) == 0 {
+		if r.final != nil {
+			return 0, r.final
+		}
+		r.final = r.readLine()
+	}
+
+	n := copy(b, r.buff)
+	r.buff = r.buff[n:]
+	return n, nil
+}
+
+// readLine decodes next base64 line, or verifies checksum and footer
+func (r *armorReader) readLine() error {
+	line, err := r.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "=") && len(line) == 9 {
+		return r.verify(line[1:])
+	}
+
+	chars := r.rest + line
+	full := len(chars) - len(chars)%4
+	r.rest = chars[full:]
+	data, derr := base64.StdEncoding.DecodeString(chars[:full])
+	if derr != nil {
+		return ErrArmor
+	}
+	r.crc.Write(data)
+	r.buff = data
+	return nil
+}
+
+func (r *armorReader) verify(sum string) error {
+	var want [4]byte
+	binary.BigEndian.PutUint32(want[:], r.crc.Sum32())
+	b, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil || r.rest != "" || !bytes.Equal(b, want[:]) {
+		return ErrArmor
+	}
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == ArmorFooter {
+			return io.EOF
+		}
+		if line != "" {
+			return ErrArmor
+		}
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+}
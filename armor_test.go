@@ -0,0 +1,85 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestArmorStream(t *testing.T) {
+	plain := bytes.Repeat(ptx, 20)
+	buf := &bytes.Buffer{}
+	w, err := rabaead.NewStreamWriter(rabaead.NewArmorWriter(buf), key, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	armored := buf.String()
+	t.Logf("aead encrypted: \n%s", armored)
+	if !strings.HasPrefix(armored, rabaead.ArmorHeader+"\n") || !strings.HasSuffix(armored, rabaead.ArmorFooter+"\n") {
+		t.Fatal("armored message must have header and footer")
+	}
+	for _, line := range strings.Split(armored, "\n") {
+		if len(line) > 64 {
+			t.Fatal("armored lines must be wrapped at 64 chars")
+		}
+	}
+
+	// pasted with leading blank line, crlf and rewrapped lines
+	pasted := "\n" + strings.ReplaceAll(strings.ReplaceAll(armored, "\n", "\r\n"), "AAA", "A\r\nAA")
+	ar, err := rabaead.NewArmorReader(strings.NewReader(pasted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rabaead.NewStreamReader(ar, key, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("armored stream plaintext mismatch")
+	}
+}
+
+func TestArmorChecksum(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := rabaead.NewArmorWriter(buf)
+	w.Write(bytes.Repeat(ptx, 5))
+	w.Close()
+
+	lines := strings.Split(buf.String(), "\n")
+	line := []byte(lines[1])
+	if line[10] = 'A'; lines[1][10] == 'A' {
+		line[10] = 'B'
+	}
+	lines[1] = string(line)
+
+	ar, err := rabaead.NewArmorReader(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(ar); err != rabaead.ErrArmor {
+		t.Fatal("err armor must returned for damaged line", err)
+	}
+
+	ar, _ = rabaead.NewArmorReader(strings.NewReader(strings.Join(lines[:2], "\n")))
+	if _, err := io.ReadAll(ar); err != io.ErrUnexpectedEOF {
+		t.Fatal("err unexpected eof must returned for truncated message", err)
+	}
+
+	if _, err := rabaead.NewArmorReader(strings.NewReader("hello\n")); err != rabaead.ErrArmor {
+		t.Fatal("err armor must returned for missing header", err)
+	}
+}
@@ -0,0 +1,98 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"sync"
+)
+
+// BatchEntry is a single message of SealBatch and OpenBatch
+type BatchEntry struct {
+	Nonce []byte
+	Text  []byte // plaintext for SealBatch, ciphertext for OpenBatch
+	AD    []byte
+	Out   []byte // sealed or opened data, a slice of returned arena
+	Err   error  // OpenBatch result of this entry
+}
+
+// SealBatch seals all entries and appends their ciphertext to arena, Out of each
+// entry is set to its own slice of returned arena. arena is only reallocated if its
+// capacity is not enough for all entries. if workers is more than 1, entries are
+// sealed by up to workers goroutines. panic occurs if any nonce len is wrong.
+// counter nonces require NewSubkeyAEAD, NewAEAD maps them to the same keystream
+func SealBatch(a cipher.AEAD, arena []byte, entries []BatchEntry, workers int) []byte {
+	ret, offs := batchArena(arena, entries, func(e *BatchEntry) int {
+		return len(e.Text) + a.Overhead()
+	})
+
+	batchRun(entries, workers, func(i int) {
+		e := &entries[i]
+		e.Out = a.Seal(ret[offs[i]:offs[i]:offs[i+1]], e.Nonce, e.Text, e.AD)
+		e.Err = nil
+	})
+	return ret
+}
+
+// OpenBatch opens all entries and appends their plaintext to arena, Out of each
+// entry is set to its own slice of returned arena and Err to its open error.
+// ErrAuthMsg is returned if any entry is not verified, entries with non-nil Err
+// have nil Out. if workers is more than 1, entries are opened by up to workers
+// goroutines. panic occurs if any nonce len is wrong
+func OpenBatch(a cipher.AEAD, arena []byte, entries []BatchEntry, workers int) ([]byte, error) {
+	ret, offs := batchArena(arena, entries, func(e *BatchEntry) int {
+		if n := len(e.Text) - a.Overhead(); n > 0 {
+			return n
+		}
+		return 0
+	})
+
+	batchRun(entries, workers, func(i int) {
+		e := &entries[i]
+		e.Out, e.Err = a.Open(ret[offs[i]:offs[i]:offs[i+1]], e.Nonce, e.Text, e.AD)
+	})
+
+	for i := range entries {
+		if entries[i].Err != nil {
+			return ret, ErrAuthMsg
+		}
+	}
+	return ret, nil
+}
+
+// batchArena grows arena by output size of all entries, offs[i] is start of
+// entry i output in returned arena and offs[len(entries)] is its end
+func batchArena(arena []byte, entries []BatchEntry, size func(*BatchEntry) int) ([]byte, []int) {
+	offs := make([]int, len(entries)+1)
+	offs[0] = len(arena)
+	for i := range entries {
+		offs[i+1] = offs[i] + size(&entries[i])
+	}
+
+	ret, _ := headtail(arena, offs[len(entries)]-len(arena))
+	return ret, offs
+}
+
+// batchRun runs f for every entry index, on up to workers goroutines
+func batchRun(entries []BatchEntry, workers int, f func(i int)) {
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+
+	if workers <= 1 {
+		for i := range entries {
+			f(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < len(entries); i += workers {
+				f(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
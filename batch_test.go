@@ -0,0 +1,85 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// batchEntries returns n entries with counter nonces, they need NewSubkeyAEAD
+func batchEntries(n int) []rabaead.BatchEntry {
+	entries := make([]rabaead.BatchEntry, n)
+	for i := range entries {
+		nonce := make([]byte, 8)
+		binary.LittleEndian.PutUint64(nonce, uint64(i))
+		entries[i] = rabaead.BatchEntry{
+			Nonce: nonce,
+			Text:  ptx[:i%len(ptx)],
+			AD:    nonce,
+		}
+	}
+	return entries
+}
+
+// TestBatch seal and open many messages into a single arena
+func TestBatch(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 1, 4} {
+		entries := batchEntries(100)
+		arena := rabaead.SealBatch(aead, make([]byte, 0, 4096), entries, workers)
+
+		var total int
+		opens := make([]rabaead.BatchEntry, len(entries))
+		for i, e := range entries {
+			total += len(e.Text) + aead.Overhead()
+			if !bytes.Equal(e.Out, aead.Seal(nil, e.Nonce, e.Text, e.AD)) {
+				t.Fatal("batch sealed data is not same as Seal")
+			}
+			opens[i] = rabaead.BatchEntry{Nonce: e.Nonce, Text: e.Out, AD: e.AD}
+		}
+
+		if len(arena) != total {
+			t.Fatal("wrong arena len")
+		}
+
+		opens[7].Text = append([]byte{}, opens[7].Text...)
+		opens[7].Text[0] ^= 0x01
+		opens[9].Text = opens[9].Text[:4]
+
+		if _, err := rabaead.OpenBatch(aead, nil, opens, workers); err != rabaead.ErrAuthMsg {
+			t.Fatal("err auth must returned")
+		}
+
+		for i, e := range opens {
+			if i == 7 || i == 9 {
+				if e.Err != rabaead.ErrAuthMsg || e.Out != nil {
+					t.Fatal("err auth must returned for tampered entry")
+				}
+				continue
+			}
+			if e.Err != nil {
+				t.Fatal(e.Err)
+			}
+			if !bytes.Equal(e.Out, entries[i].Text) {
+				t.Fatal("decrypted data is not same as plaintext")
+			}
+		}
+	}
+}
+
+func BenchmarkSealBatch(b *testing.B) {
+	aead, _ := rabaead.NewSubkeyAEAD(key)
+	entries := batchEntries(1000)
+	arena := make([]byte, 0, 64*1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rabaead.SealBatch(aead, arena, entries, 4)
+	}
+}
@@ -0,0 +1,113 @@
+package rabaead
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabbitio"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	BoxKeyLen   = curve25519.PointSize // x25519 public and private key len: 32byte
+	BoxOverhead = BoxKeyLen + poly1305.TagSize
+)
+
+var ErrBoxKey = errors.New("rabaead: x25519 key must be exactly 32 byte len")
+
+// GenerateBoxKey generates a x25519 key pair for SealAnonymous and OpenAnonymous
+// if rnd is nil, crypto/rand.Reader is used as source of entropy
+func GenerateBoxKey(rnd io.Reader) (pub, priv []byte, err error) {
+	if rnd == nil {
+		rnd = rand.Reader
+	}
+
+	priv = make([]byte, curve25519.ScalarSize)
+	if _, err = io.ReadFull(rnd, priv); err != nil {
+		return nil, nil, err
+	}
+
+	pub, err = curve25519.X25519(priv, curve25519.Basepoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pub, priv, nil
+}
+
+// SealAnonymous seals a plaintext to the recipient x25519 public key, an ephemeral
+// key pair is generated for each message and its public part is prepended to the box.
+// sender is anonymous, recipient cannot tell who sealed the box.
+// there is 32byte ephemeral key + 16byte poly1305 tag overhead per box
+func SealAnonymous(recipientPub, plaintext []byte) ([]byte, error) {
+	if len(recipientPub) != BoxKeyLen {
+		return nil, ErrBoxKey
+	}
+
+	ephPub, ephPriv, err := GenerateBoxKey(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key, nonce, err := boxKeyNonce(ephPriv, recipientPub, ephPub, recipientPub)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newRabbitAead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, BoxKeyLen, BoxKeyLen+len(plaintext)+aead.Overhead())
+	copy(out, ephPub)
+	return aead.Seal(out, nonce, plaintext, nil), nil
+}
+
+// OpenAnonymous opens a box sealed by SealAnonymous with recipient x25519 private key.
+// if box is corrupted or sealed for another recipient, ErrAuthMsg will be returned
+func OpenAnonymous(recipientPriv, box []byte) ([]byte, error) {
+	if len(recipientPriv) != BoxKeyLen {
+		return nil, ErrBoxKey
+	}
+
+	if len(box) < BoxOverhead {
+		return nil, ErrAuthMsg
+	}
+
+	recipientPub, err := curve25519.X25519(recipientPriv, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	ephPub := box[:BoxKeyLen]
+	key, nonce, err := boxKeyNonce(recipientPriv, ephPub, ephPub, recipientPub)
+	if err != nil {
+		return nil, ErrAuthMsg
+	}
+
+	aead, err := newRabbitAead(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open([]byte{}, nonce, box[BoxKeyLen:], nil)
+}
+
+// boxKeyNonce derives rabbit key and iv from x25519 shared secret,
+// ephemeral and recipient public keys: sha256(shared || ephPub || recipientPub)
+func boxKeyNonce(priv, peer, ephPub, recipientPub []byte) (key, nonce []byte, err error) {
+	shared, err := curve25519.X25519(priv, peer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := sha256.New()
+	h.Write(shared)
+	h.Write(ephPub)
+	h.Write(recipientPub)
+	sum := h.Sum(nil)
+	return sum[:rabbitio.KeyLen], sum[rabbitio.KeyLen : rabbitio.KeyLen+rabbitio.IVXLen], nil
+}
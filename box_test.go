@@ -0,0 +1,65 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// TestSealAnonymous seal a box to recipient public key and open it with private key
+func TestSealAnonymous(t *testing.T) {
+	pub, priv, err := rabaead.GenerateBoxKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := rabaead.SealAnonymous(pub, ptx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("sealed box: %x\n", box)
+
+	if len(box) != len(ptx)+rabaead.BoxOverhead {
+		t.Fatal("wrong sealed box len")
+	}
+
+	bf, err := rabaead.OpenAnonymous(priv, box)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("opened box: %x\n", bf)
+
+	if !bytes.Equal(bf, ptx) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+}
+
+func TestOpenAnonymousErr(t *testing.T) {
+	pub, _, err := rabaead.GenerateBoxKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, other, err := rabaead.GenerateBoxKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	box, err := rabaead.SealAnonymous(pub, ptx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rabaead.OpenAnonymous(other, box); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+
+	if _, err := rabaead.OpenAnonymous(other, box[:rabaead.BoxOverhead-1]); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+
+	if _, err := rabaead.SealAnonymous(pub[:16], ptx); err != rabaead.ErrBoxKey {
+		t.Fatal("err box key must returned")
+	}
+}
@@ -0,0 +1,199 @@
+package rabaead
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"io"
+
+	"github.com/sina-ghaderi/poly1305"
+)
+
+// checkpoint mode of streamWriter: after every size bytes of ciphertext, a checkpoint tag
+// is written. checkpoint i is poly1305 with one-time key sha256(key || nonce || label || i)
+// of: (i == 0 ? additional data : checkpoint tag i-1) || segment i || lens, so checkpoints
+// are chained. stream still ends with the poly1305 tag of the whole ciphertext:
+// segment 0 || tag 0 || ... || segment n (shorter than size) || stream tag
+const checkpointLabel = "rabaead stream checkpoint"
+
+type checkpoint struct {
+	size  int // segment size, zero if checkpoint mode is disabled
+	used  int // ciphertext bytes in current segment
+	index uint64
+	key   []byte
+	nonce []byte
+	mac   *poly1305.MAC
+	hlen  int // len of mac head, additional data or previous tag
+	prev  [poly1305.TagSize]byte
+}
+
+// SetCheckpoint enables checkpoint mode: a checkpoint tag is written after every size
+// bytes of plaintext, so data up to the last checkpoint can be recovered and verified
+// if Close is never called, see RecoverStream. zero size disables it. reader must use
+// the same size, it must be called before first Write
+func (w *streamWriter) SetCheckpoint(size int) { w.cp.enable(w.ie, size) }
+
+// SetCheckpoint enables checkpoint mode, see streamWriter SetCheckpoint. in this mode
+// each segment is returned only after its checkpoint is verified, so read data is
+// reliable. data after the last checkpoint is verified by stream tag at EOF, it is
+// io.ErrUnexpectedEOF if there is no valid stream tag. it must be called before first Read
+func (r *streamReader) SetCheckpoint(size int) {
+	r.cp.enable(r.ie, size)
+	if size > 0 {
+		r.blck = make([]byte, size+2*poly1305.TagSize)
+		r.plin = make([]byte, size)
+	}
+}
+
+// RecoverStream copies authenticated plaintext of checkpointed stream r to w and
+// returns its len. nil error means whole stream is authenticated. otherwise n covers
+// data up to the last verified checkpoint and error is ErrAuthMsg if a checkpoint does
+// not match, or io.ErrUnexpectedEOF if tail after last checkpoint is not followed by a
+// valid stream tag, like after a crash before Close
+func RecoverStream(w io.Writer, r io.Reader, key, nonce []byte, f AdditionalFunc, size int) (int64, error) {
+	sr, err := NewStreamReader(r, key, nonce, f)
+	if err != nil {
+		return 0, err
+	}
+	sr.SetCheckpoint(size)
+	return sr.WriteTo(w)
+}
+
+func (c *checkpoint) enable(ie *ioaead, size int) {
+	if size < 0 {
+		size = 0
+	}
+	c.size = size
+	c.key = ie.key
+	c.nonce = ie.nonce
+}
+
+// Write writes ciphertext into checkpoint mac, if checkpoint mode is enabled
+func (c *checkpoint) Write(b []byte) (int, error) {
+	if c.mac != nil {
+		c.mac.Write(b)
+	}
+	return len(b), nil
+}
+
+// begin starts mac of checkpoint 0 with additional data
+func (c *checkpoint) begin(ad []byte) {
+	if c.size == 0 {
+		return
+	}
+	c.start()
+	c.hlen = len(ad)
+	writePadding(c.mac, ad)
+}
+
+// start starts mac of current checkpoint with its one-time key
+func (c *checkpoint) start() {
+	var key [polykeylen]byte
+	h := sha256.New()
+	h.Write(c.key)
+	h.Write(c.nonce)
+	h.Write([]byte(checkpointLabel))
+	h.Write(uint64Little(c.index))
+	h.Sum(key[:0])
+	c.mac = poly1305.New(&key)
+}
+
+// end returns tag of current checkpoint and starts the next one
+func (c *checkpoint) end() []byte {
+	if rem := c.used % 16; rem != 0 {
+		var buf [16]byte
+		c.mac.Write(buf[:16-rem])
+	}
+	writeUint64(c.mac, c.hlen)
+	writeUint64(c.mac, c.used)
+	c.mac.Sum(c.prev[:0])
+
+	c.index++
+	c.used = 0
+	c.start()
+	c.hlen = len(c.prev)
+	c.mac.Write(c.prev[:])
+	return c.prev[:]
+}
+
+// writeCheckpoint writes b and a checkpoint tag whenever a segment is full
+func (w *streamWriter) writeCheckpoint(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		s := w.cp.size - w.cp.used
+		if s > len(b) {
+			s = len(b)
+		}
+
+		sw, err := w.writer.Write(b[:s])
+		w.cp.used += sw
+		w.nwr += sw
+		n += sw
+		if err != nil {
+			return n, err
+		}
+		b = b[s:]
+
+		if w.cp.used == w.cp.size {
+			if _, err := writeFull(w.plainWriter, w.cp.end()); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// fillCheckpoint reads a segment and its checkpoint tag, holding back 16 bytes which
+// may be the stream tag. at EOF, a shorter segment must be followed by stream tag,
+// otherwise it is a partial segment of a crashed writer and it is not returned
+func (r *streamReader) fillCheckpoint() error {
+	size := r.cp.size
+	n, err := io.ReadFull(r.read, r.blck[r.have:])
+	r.have += n
+	if err == nil {
+		r.segment(size)
+		return nil
+	}
+	if err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	switch {
+	case r.have >= size+poly1305.TagSize:
+		// full segment without stream tag, writer did not run Close
+		r.final = io.ErrUnexpectedEOF
+		r.segment(size)
+	case r.have >= poly1305.TagSize:
+		s := r.have - poly1305.TagSize
+		r.ie.poly.Write(r.blck[:s])
+		r.nwr += s
+		if r.final = r.verify(r.blck[s:r.have]); r.final == io.EOF {
+			r.cip.XORKeyStream(r.plin[:s], r.blck[:s])
+			r.buff = r.plin[:s]
+		} else {
+			// no stream tag after last checkpoint
+			r.final = io.ErrUnexpectedEOF
+		}
+		r.have = 0
+	default:
+		r.final = io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// segment verifies checkpoint tag of a full segment and opens it
+func (r *streamReader) segment(size int) {
+	seg, tag := r.blck[:size], r.blck[size:size+poly1305.TagSize]
+	r.cp.mac.Write(seg)
+	r.cp.used = size
+	if subtle.ConstantTimeCompare(r.cp.end(), tag) != 1 {
+		r.final = ErrAuthMsg
+		r.have = 0
+		return
+	}
+
+	r.ie.poly.Write(seg)
+	r.cip.XORKeyStream(r.plin[:size], seg)
+	r.buff = r.plin[:size]
+	r.nwr += size
+	r.have = copy(r.blck, r.blck[size+poly1305.TagSize:r.have])
+}
@@ -0,0 +1,93 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestStreamCheckpoint(t *testing.T) {
+	adfunc := func() []byte { return []byte("additional data") }
+	plain := bytes.Repeat(ptx, 10)
+
+	for _, size := range []int{16, 33, len(plain), len(plain) + 1} {
+		buf := &bytes.Buffer{}
+		w, err := rabaead.NewStreamWriter(buf, key, iv, adfunc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.SetCheckpoint(size)
+		if _, err := w.Write(plain[:7]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(plain[7:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if buf.Len() != len(plain)+16*(len(plain)/size+1) {
+			t.Fatalf("wrong checkpointed stream len, checkpoint size %d", size)
+		}
+
+		r, _ := rabaead.NewStreamReader(bytes.NewReader(buf.Bytes()), key, iv, adfunc)
+		r.SetCheckpoint(size)
+		bf, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bf, plain) {
+			t.Fatal("decrypted data is not same as plaintext")
+		}
+	}
+}
+
+// TestRecoverStream stream without Close must be recovered up to last checkpoint
+func TestRecoverStream(t *testing.T) {
+	plain := bytes.Repeat(ptx, 10)
+	size := 100
+
+	buf := &bytes.Buffer{}
+	w, _ := rabaead.NewStreamWriter(buf, key, iv, nil)
+	w.SetCheckpoint(size)
+	w.Write(plain)
+	crashed := buf.Bytes() // Close is never called
+
+	last := len(plain) / size * size
+	for _, cut := range []int{0, 5, 20, 37} {
+		out := &bytes.Buffer{}
+		n, err := rabaead.RecoverStream(out, bytes.NewReader(crashed[:len(crashed)-cut]), key, iv, nil, size)
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("err unexpected EOF must returned, got %v", err)
+		}
+
+		want := last
+		if cut > len(plain)-last {
+			want -= size
+		}
+		if int(n) != want || !bytes.Equal(out.Bytes(), plain[:want]) {
+			t.Fatalf("recovered %d bytes, want %d", n, want)
+		}
+	}
+
+	// partial segment after last checkpoint, long enough to be taken for a stream tag
+	buf.Reset()
+	w, _ = rabaead.NewStreamWriter(buf, key, iv, nil)
+	w.SetCheckpoint(size)
+	w.Write(bytes.Repeat(ptx, 16)[:250])
+	n, err := rabaead.RecoverStream(io.Discard, bytes.NewReader(buf.Bytes()), key, iv, nil, size)
+	if err != io.ErrUnexpectedEOF || n != 200 {
+		t.Fatalf("recovered %d bytes with %v, want 200 bytes and unexpected EOF", n, err)
+	}
+
+	// tampered checkpointed segment is not recovered
+	tampered := append([]byte{}, buf.Bytes()...)
+	tampered[size+16+20] ^= 0x01
+	n, err = rabaead.RecoverStream(io.Discard, bytes.NewReader(tampered), key, iv, nil, size)
+	if err != rabaead.ErrAuthMsg || n != int64(size) {
+		t.Fatal("err auth must returned")
+	}
+}
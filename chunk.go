@@ -1,7 +1,6 @@
 package rabaead
 
 import (
-	"bytes"
 	"crypto/cipher"
 	"encoding/binary"
 	"errors"
@@ -13,6 +12,8 @@ import (
 const cmrs = 0x02 // chunk size indicator,
 // without this reader cannot calculate actual size of plaintext
 
+const finalChunk = 1 << 63 // final chunk flag of counter nonce
+
 // additional data func, return value is used as AD in Seal and Open
 // nil AdFunc is harmless and equal to func()[]byte{return nil}
 type AdditionalFunc func() []byte
@@ -22,17 +23,38 @@ type chunkReader struct {
 	csize int
 	rader io.Reader
 	buff  []byte
+	chnk  []byte // reused sealed chunk buffer, buff is a view into it
 	nonce []byte
 	adexe AdditionalFunc
+	count bool   // counter nonce mode
+	cnon  []byte // reused counter nonce
+	cadd  []byte // reused counter additional data
+	sprt  []byte // opened chunk buffer in counter mode, buff is a view into it
+	index uint64 // next chunk index
+	final bool   // final chunk is read
+	pos   uint64 // next chunk position, counted in every mode
+	plain int64  // returned plaintext bytes
+	clen  int    // plaintext len of last read chunk
+	skip  int    // bytes to drop from next chunk, when resumed from a checkpoint
+	mtree *merkleTree
 }
 
 type chunkWriter struct {
-	aead   cipher.AEAD
-	csize  int
-	writer io.Writer
-	buff   []byte
-	nonce  []byte
-	adexe  AdditionalFunc
+	aead    cipher.AEAD
+	csize   int
+	writer  io.Writer
+	buff    []byte
+	chnk    []byte // reused sealed chunk buffer
+	nonce   []byte
+	adexe   AdditionalFunc
+	padding PaddingFunc
+	total   int
+	chunks  int
+	count   bool   // counter nonce mode
+	cnon    []byte // reused counter nonce
+	cadd    []byte // reused counter additional data
+	final   bool   // final chunk is written
+	mtree   *merkleTree
 }
 
 // NewChunkReader returns a chunkReader data type, this reader reads and open() aead
@@ -52,6 +74,7 @@ func NewChunkReader(r io.Reader, chnk int, a cipher.AEAD, nonce []byte, f Additi
 	s := &chunkReader{
 		aead:  a,
 		buff:  []byte{},
+		chnk:  make([]byte, cmrs+chnk+a.Overhead()),
 		nonce: make([]byte, len(nonce)),
 		csize: chnk,
 		rader: r,
@@ -82,6 +105,7 @@ func NewChunkWriter(w io.Writer, chnk int, a cipher.AEAD, nonce []byte, f Additi
 	s := &chunkWriter{
 		aead:   a,
 		buff:   []byte{},
+		chnk:   make([]byte, cmrs+chnk+a.Overhead()),
 		nonce:  make([]byte, len(nonce)),
 		csize:  chnk,
 		writer: w,
@@ -96,8 +120,35 @@ func NewChunkWriter(w io.Writer, chnk int, a cipher.AEAD, nonce []byte, f Additi
 	return s, nil
 }
 
-// Close method, if there is any
+// SetPadding sets padding policy of the written stream. each chunk is already sealed
+// with csize bytes, so only number of chunks reveals plaintext len. on Close, empty
+// chunks are written until chunks cover padded len of total written plaintext.
+// readers skip empty chunks, so there is no need to enable it on reader side
+func (w *chunkWriter) SetPadding(f PaddingFunc) { w.padding = f }
+
+// SetCounter enables counter nonce mode: nonce of chunk i is nonce xor i (little endian)
+// and i is appended to additional data of the chunk. Close writes an empty final chunk,
+// which has the top bit of its counter set. so reader detects reordered, dropped, replayed
+// and truncated chunks. both sides must enable it and it must be called before first Write.
+// aead should be NewSubkeyAEAD, NewAEAD maps consecutive counters to the same keystream
+func (w *chunkWriter) SetCounter(enable bool) {
+	w.count = enable
+	w.cnon = make([]byte, rabbitio.IVXLen)
+}
+
+// Close writes padding chunks if padding is enabled, final chunk in counter mode and
+// merkle tree in merkle mode, then runs Close method of underlying writer, if there is any
 func (w *chunkWriter) Close() error {
+	if err := w.padChunks(); err != nil {
+		return err
+	}
+
+	if w.count && !w.final {
+		if err := w.sealFinal(); err != nil {
+			return err
+		}
+	}
+
 	if c, ok := w.writer.(io.Closer); ok {
 		return c.Close()
 	}
@@ -121,18 +172,14 @@ func (w *chunkWriter) Write(b []byte) (n int, err error) {
 }
 
 func (w *chunkWriter) write() (int, error) {
-	size := cmrs + w.csize + w.aead.Overhead()
-	chnk := make([]byte, size)
 	var n int
 	var err error
 
 	if len(w.buff) > 0 {
-		s := copy(chnk[cmrs:len(chnk)-w.aead.Overhead()], w.buff)
+		s := copy(w.chnk[cmrs:cmrs+w.csize], w.buff)
 		w.buff = w.buff[s:]
-		copy(chnk[0:cmrs], uint16Little(uint16(s)))
 
-		w.aead.Seal(chnk[:0], w.nonce, chnk[:cmrs+w.csize], w.adexe())
-		_, err = w.writer.Write(chnk)
+		err = w.sealChunk(s)
 		if err != nil {
 			return n, err
 		}
@@ -142,6 +189,99 @@ func (w *chunkWriter) write() (int, error) {
 	return n, err
 }
 
+// ReadFrom reads plaintext from src until EOF directly into the chunk buffer and
+// seals it in full chunks, only the last chunk may be shorter. short reads of src are
+// collected in one chunk, so a chunk is sealed only after it is full or src ends.
+// to seal each read of an interactive src without delay, hide ReadFrom of writer
+func (w *chunkWriter) ReadFrom(src io.Reader) (int64, error) {
+	var n int64
+	for {
+		var s int
+		var err error
+		for s < w.csize && err == nil {
+			var r int
+			r, err = src.Read(w.chnk[cmrs+s : cmrs+w.csize])
+			s += r
+		}
+
+		if s > 0 {
+			if err := w.sealChunk(s); err != nil {
+				return n, err
+			}
+			n += int64(s)
+		}
+
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// sealChunk seals first s bytes of plaintext in chunk buffer,
+// rest of the chunk is zeroed, since chunk buffer is reused
+func (w *chunkWriter) sealChunk(s int) error {
+	ptxt := w.chnk[cmrs : cmrs+w.csize]
+	for i := s; i < len(ptxt); i++ {
+		ptxt[i] = 0x00
+	}
+
+	nonce, ad := w.nonce, w.adexe()
+	if w.count {
+		nonce = chunkNonce(w.cnon, w.nonce, uint64(w.chunks), w.final)
+		w.cadd = append(append(w.cadd[:0], ad...), nonce...)
+		ad = w.cadd
+	}
+
+	binary.LittleEndian.PutUint16(w.chnk[0:cmrs], uint16(s))
+	w.aead.Seal(w.chnk[:0], nonce, w.chnk[:cmrs+w.csize], ad)
+	if _, err := w.writer.Write(w.chnk); err != nil {
+		return err
+	}
+
+	if w.mtree != nil && !w.final {
+		w.mtree.add(w.chnk[len(w.chnk)-w.aead.Overhead():])
+	}
+	w.total += s
+	w.chunks++
+	return nil
+}
+
+// sealFinal seals final chunk, which carries merkle trailer in merkle mode
+func (w *chunkWriter) sealFinal() error {
+	if w.mtree == nil {
+		w.final = true
+		return w.sealChunk(0)
+	}
+
+	if w.csize < merkleTrailer {
+		return errMerkleChunk
+	}
+	s := copy(w.chnk[cmrs:], w.mtree.trailer())
+	w.final = true
+	if err := w.sealChunk(s); err != nil {
+		return err
+	}
+	_, err := writeFull(w.writer, w.mtree.marshal())
+	return err
+}
+
+func (w *chunkWriter) padChunks() error {
+	if w.padding == nil {
+		return nil
+	}
+
+	want := (w.padding(w.total) + w.csize - 1) / w.csize
+	for w.chunks < want {
+		if err := w.sealChunk(0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Read reads and open() ciphertext chunk from underlying reader
 // read would not report overhead data (chunk size marker and poly1305 tag) in its
 // return value. if the read data from underlying reader is corrupted, ErrAuthMsg
@@ -172,53 +312,145 @@ func (r *chunkReader) Read(b []byte) (int, error) {
 	return n, nil
 }
 
+// WriteTo reads and opens chunks until underlying reader returns EOF,
+// each opened chunk is written to w directly
+func (r *chunkReader) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for {
+		if len(r.buff) > 0 {
+			s, err := writeFull(w, r.buff)
+			r.buff = r.buff[s:]
+			n += int64(s)
+			r.plain += int64(s)
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		_, err := r.read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// SetCounter enables counter nonce mode, see chunkWriter SetCounter. in this mode
+// chunks after final chunk are rejected with ErrAuthMsg and EOF before final chunk
+// is reported as io.ErrUnexpectedEOF. it must be called before first Read
+func (r *chunkReader) SetCounter(enable bool) {
+	r.count = enable
+	r.cnon = make([]byte, rabbitio.IVXLen)
+	r.sprt = make([]byte, len(r.chnk))
+}
+
 func (r *chunkReader) readTo(b []byte) (int, error) {
 	var n int
 	if len(r.buff) > 0 {
 		n = copy(b, r.buff)
 		r.buff = r.buff[n:]
+		r.plain += int64(n)
 		return n, nil
 	}
 
+	// skip empty padding chunks
 	sr, err := r.read()
+	for sr == 0 && err == nil {
+		sr, err = r.read()
+	}
 	n = copy(b, r.buff[:sr])
 	r.buff = r.buff[n:]
+	r.plain += int64(n)
 	return n, err
 }
 
 func (r *chunkReader) read() (int, error) {
 
 	var n int
-	size := cmrs + r.csize + r.aead.Overhead()
-	chnk := make([]byte, size)
-	chLE := uint16Little(uint16(r.csize))
-
-	si, err := io.ReadFull(r.rader, chnk)
+	si, err := io.ReadFull(r.rader, r.chnk)
 	if err != nil {
+		if err == io.EOF && r.count && !r.final {
+			return n, io.ErrUnexpectedEOF
+		}
 		return n, err
 	}
 
+	// buff is empty here, so chunk buffer can be overwritten
 	if si > 0 {
-		_, err = r.aead.Open(chnk[:0], r.nonce, chnk, r.adexe())
+		ptxt, err := r.open()
 		if err != nil {
 			return n, err
 		}
 
-		if bytes.Equal(chnk[0:cmrs], chLE) {
-			n += r.csize
-			r.buff = append(r.buff, chnk[cmrs:cmrs+r.csize]...)
-		} else {
-			f := binary.LittleEndian.Uint16(chnk[0:cmrs])
-			n += int(f)
-			r.buff = append(r.buff, chnk[cmrs:cmrs+f]...)
+		f := int(binary.LittleEndian.Uint16(ptxt[0:cmrs]))
+		if f > r.csize || r.skip > f {
+			return n, ErrAuthMsg
+		}
+
+		if r.mtree != nil {
+			if !r.final {
+				r.mtree.add(r.chnk[len(r.chnk)-r.aead.Overhead():])
+			} else if err := r.mtree.verify(r.rader, ptxt[cmrs:cmrs+f]); err != nil {
+				return n, err
+			} else {
+				f = 0 // trailer is not plaintext
+			}
 		}
+		r.pos++
+		r.clen = f
+		r.buff = ptxt[cmrs+r.skip : cmrs+f]
+		n += f - r.skip
+		r.skip = 0
 	}
 
 	return n, err
 }
 
-func uint16Little(n uint16) []byte {
-	b := make([]byte, cmrs)
-	binary.LittleEndian.PutUint16(b, n)
-	return b
+// open opens chunk buffer, in counter mode chunk is opened into a separate
+// buffer, so it can be opened again as final chunk if first try fails
+func (r *chunkReader) open() ([]byte, error) {
+	if !r.count {
+		return r.aead.Open(r.chnk[:0], r.nonce, r.chnk, r.adexe())
+	}
+
+	if r.final {
+		return nil, ErrAuthMsg
+	}
+
+	ad := r.adexe()
+	nonce := chunkNonce(r.cnon, r.nonce, r.index, false)
+	r.cadd = append(append(r.cadd[:0], ad...), nonce...)
+	ptxt, err := r.aead.Open(r.sprt[:0], nonce, r.chnk, r.cadd)
+	if err != nil {
+		nonce = chunkNonce(r.cnon, r.nonce, r.index, true)
+		r.cadd = append(append(r.cadd[:0], ad...), nonce...)
+		if ptxt, err = r.aead.Open(r.sprt[:0], nonce, r.chnk, r.cadd); err != nil {
+			return nil, err
+		}
+		r.final = true
+	}
+
+	r.index++
+	return ptxt, nil
+}
+
+// chunkNonce writes nonce xor index into dst, top bit of index is final chunk flag.
+// zero len nonce is treated as 8 zero bytes
+func chunkNonce(dst, nonce []byte, index uint64, final bool) []byte {
+	if index&finalChunk != 0 {
+		panic("rabaead: chunk counter exhausted")
+	}
+	if final {
+		index |= finalChunk
+	}
+
+	var base uint64
+	if len(nonce) == rabbitio.IVXLen {
+		base = binary.LittleEndian.Uint64(nonce)
+	}
+	binary.LittleEndian.PutUint64(dst, base^index)
+	return dst
 }
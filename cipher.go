@@ -14,8 +14,9 @@ const polykeylen = 0x20 // poly1305 key len: 32byte
 var ErrAuthMsg = errors.New("rabaead: message authentication failed")
 
 type rabbitPoly1305 struct {
-	key       []byte // rabbit cipher key
-	noncesize int    // rabbit iv size
+	state     rabbitState // rabbit cipher state after key schedule
+	noncesize int         // rabbit iv size
+	split     bool        // encrypt from keystream byte 32, after poly1305 key
 }
 
 // NewAEAD returns a rabbit aead data-type
@@ -29,9 +30,8 @@ func newRabbitAead(key []byte) (cipher.AEAD, error) {
 
 	rabbitAead := &rabbitPoly1305{
 		noncesize: rabbitio.IVXLen,
-		key:       make([]byte, rabbitio.KeyLen),
+		state:     newRabbitState(key),
 	}
-	copy(rabbitAead.key[:], key)
 	return rabbitAead, nil
 
 }
@@ -42,28 +42,45 @@ func (c *rabbitPoly1305) Overhead() int { return poly1305.TagSize }
 // NonceSize returns rabbit iv len: 8byte
 func (c *rabbitPoly1305) NonceSize() int { return c.noncesize }
 
+// xorFromStart xor src with keystream from byte 0, first 32 bytes of keystream
+// are poly1305 key and the rest is read from s, which is already at byte 32
+func xorFromStart(s *rabbitStream, polyKey *[polykeylen]byte, dst, src []byte) {
+	k := len(src)
+	if k > polykeylen {
+		k = polykeylen
+	}
+	for i := 0; i < k; i++ {
+		dst[i] = src[i] ^ polyKey[i]
+	}
+	s.XORKeyStream(dst[k:], src[k:])
+}
+
+// xorKeyStream xor src with keystream of message: from byte 0, which also is poly1305
+// key, for rabbitio compatibility or from byte 32 in split mode, so poly1305 key can
+// not be recovered from known plaintext
+func (c *rabbitPoly1305) xorKeyStream(s *rabbitStream, polyKey *[polykeylen]byte, dst, src []byte) {
+	if c.split {
+		s.XORKeyStream(dst, src)
+		return
+	}
+	xorFromStart(s, polyKey, dst, src)
+}
+
 func (c *rabbitPoly1305) sealRabbit(dst, nonce, plaintext, ad []byte) []byte {
 	ret, out := headtail(dst, len(plaintext)+poly1305.TagSize)
 	ciphertext, tag := out[:len(plaintext)], out[len(plaintext):]
-	if subtle.InexactOverlap(out, ciphertext) {
+	if subtle.InexactOverlap(out, plaintext) {
 		panic("rabaead: invalid buffer memory overlap")
 	}
 
+	var s rabbitStream
 	var polyKey [polykeylen]byte
-	s, err := rabbitio.NewCipher(c.key, nonce)
-	if err != nil {
-		panic(err)
-	}
+	c.state.stream(nonce, &s)
 	s.XORKeyStream(polyKey[:], polyKey[:])
 	p := poly1305.New(&polyKey)
 	writePadding(p, ad)
 
-	s, err = rabbitio.NewCipher(c.key, nonce)
-	if err != nil {
-		panic(err)
-	}
-	s.XORKeyStream(ciphertext, plaintext)
-
+	c.xorKeyStream(&s, &polyKey, ciphertext, plaintext)
 	writePadding(p, ciphertext)
 
 	writeUint64(p, len(ad))
@@ -77,11 +94,9 @@ func (c *rabbitPoly1305) openRabbit(dst, nonce, ciphertext, ad []byte) ([]byte,
 	tag := ciphertext[len(ciphertext)-poly1305.TagSize:]
 	ciphertext = ciphertext[:len(ciphertext)-poly1305.TagSize]
 
+	var s rabbitStream
 	var polyKey [polykeylen]byte
-	s, err := rabbitio.NewCipher(c.key, nonce)
-	if err != nil {
-		panic(err)
-	}
+	c.state.stream(nonce, &s)
 	s.XORKeyStream(polyKey[:], polyKey[:])
 
 	p := poly1305.New(&polyKey)
@@ -101,15 +116,12 @@ func (c *rabbitPoly1305) openRabbit(dst, nonce, ciphertext, ad []byte) ([]byte,
 		return nil, ErrAuthMsg
 	}
 
-	s, err = rabbitio.NewCipher(c.key, nonce)
-	if err != nil {
-		panic(err)
-	}
-	s.XORKeyStream(out, ciphertext)
+	c.xorKeyStream(&s, &polyKey, out, ciphertext)
 	return ret, nil
 }
 
 // Open opens a rabbit aead ciphertext.
+// ciphertext and dst may overlap exactly or not at all, see OpenInPlace.
 // panic occurs if nonce len is not equal to IVXLen (8byte) or zero
 // if data is not verified, ErrAuthMsg will be returned
 func (c *rabbitPoly1305) Open(dst, nonce, ciphertext, ad []byte) ([]byte, error) {
@@ -125,6 +137,7 @@ func (c *rabbitPoly1305) Open(dst, nonce, ciphertext, ad []byte) ([]byte, error)
 }
 
 // Seal seals a plaintext into the rabbit aead ciphertext.
+// plaintext and dst may overlap exactly or not at all, see SealInPlace.
 // panic occurs if nonce len is not equal to IVXLen (8byte) or zero
 func (c *rabbitPoly1305) Seal(dst, nonce, plaintext, ad []byte) []byte {
 	if uint64(len(plaintext)) > (1<<38)-64 {
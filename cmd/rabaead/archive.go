@@ -0,0 +1,228 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sina-ghaderi/poly1305"
+)
+
+// archive: header || tar stream of a directory, sealed in chunks like a single file
+// with larger chunks. each chunk is authenticated before it
+// is extracted, so a corrupted chunk is reported with the entry it belongs to
+const (
+	modeArchive   = 0x02
+	archiveChunk  = 0x8000
+	archiveSealed = 2 + archiveChunk + poly1305.TagSize
+)
+
+var errUnsafePath = errors.New("unsafe path in archive")
+
+// encryptDir writes header and sealed tar stream of dir to w
+func encryptDir(w io.Writer, dir string, key []byte) error {
+	h, err := newHeader(modeArchive)
+	if err != nil {
+		return err
+	}
+
+	cw, err := sealChunks(w, key, h, archiveChunk)
+	if err != nil {
+		return err
+	}
+
+	// tar writes 512 byte blocks, buffer them into full chunks
+	bw := bufio.NewWriterSize(cw, archiveChunk)
+	tw := tar.NewWriter(bw)
+	if err := writeTar(tw, dir); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// openArchive returns a reader of opened tar stream after header h of r
+func openArchive(r io.Reader, key []byte, h fileHeader) (io.Reader, error) {
+	return openChunks(r, key, h, archiveChunk)
+}
+
+// writeTar writes directories, regular files and symlinks under root to tw,
+// with their permissions and modification times. other file types are skipped
+func writeTar(tw *tar.Writer, root string) error {
+	return filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		switch {
+		case info.Mode().IsRegular(), info.IsDir():
+		case info.Mode()&fs.ModeSymlink != 0:
+			if link, err = os.Readlink(name); err != nil {
+				return err
+			}
+		default:
+			log.Printf("%s: skipping %s file", rel, info.Mode().Type())
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Format = tar.FormatPAX // keeps sub-second modification times
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+// extractTar extracts tar stream into dest, regular files are written to a temp file
+// and renamed into place after all their chunks are authenticated. an error names the
+// entry it happened in, entries extracted before it are authentic and kept
+func extractTar(r io.Reader, dest string, verbose bool) error {
+	if err := os.MkdirAll(dest, 0700); err != nil {
+		return err
+	}
+
+	var dirs []*tar.Header
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+
+		name, err := extractPath(dest, hdr.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err = extractDir(name); err == nil {
+				err = os.MkdirAll(name, 0700)
+				dirs = append(dirs, hdr)
+			}
+		case tar.TypeReg:
+			err = extractFile(tr, name, hdr)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, name)
+		default:
+			log.Printf("%s: skipping unsupported entry type %q", hdr.Name, hdr.Typeflag)
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		if verbose {
+			log.Print(hdr.Name)
+		}
+	}
+
+	// tar end marker is read, final chunk must follow
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("archive end: %w", err)
+	}
+
+	// directory modification times change while they are filled, set them last
+	for i := len(dirs) - 1; i >= 0; i-- {
+		name, _ := extractPath(dest, dirs[i].Name)
+		if err := extractDir(name); err != nil {
+			return fmt.Errorf("%s: %w", dirs[i].Name, err)
+		}
+		if err := os.Chmod(name, dirs[i].FileInfo().Mode().Perm()); err != nil {
+			return fmt.Errorf("%s: %w", dirs[i].Name, err)
+		}
+		if err := os.Chtimes(name, dirs[i].AccessTime, dirs[i].ModTime); err != nil {
+			return fmt.Errorf("%s: %w", dirs[i].Name, err)
+		}
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, name string, hdr *tar.Header) error {
+	err := writeAtomic(name, hdr.FileInfo().Mode().Perm(), func(w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(name, hdr.AccessTime, hdr.ModTime)
+}
+
+// extractDir rejects directory entry name if it exists as a symlink or a non directory,
+// so MkdirAll, Chmod and Chtimes of the entry never follow a link out of dest
+func extractDir(name string) error {
+	if info, err := os.Lstat(name); err == nil && !info.IsDir() {
+		return errUnsafePath
+	}
+	return nil
+}
+
+// extractPath returns path of entry in dest, entries must stay in dest
+// and must not be written through a symlink extracted before them
+func extractPath(dest, entry string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(strings.TrimSuffix(entry, "/")))
+	if rel == "." || filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" ||
+		rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errUnsafePath
+	}
+
+	parent := dest
+	for _, elem := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if elem == "." {
+			break
+		}
+		parent = filepath.Join(parent, elem)
+		if info, err := os.Lstat(parent); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", errUnsafePath
+		}
+	}
+	return filepath.Join(dest, rel), nil
+}
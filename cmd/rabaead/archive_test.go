@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestArchive(t *testing.T) {
+	src := t.TempDir()
+	big := bytes.Repeat([]byte("plain-text"), 10000)
+	if err := os.MkdirAll(filepath.Join(src, "sub", "deep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(src, "small"), []byte("plain-text"), 0640)
+	os.WriteFile(filepath.Join(src, "sub", "deep", "big"), big, 0600)
+	os.WriteFile(filepath.Join(src, "sub", "empty"), nil, 0644)
+	if err := os.Symlink("small", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chmod(filepath.Join(src, "sub"), 0750)
+	for _, name := range []string{"small", "sub/deep/big", "sub/deep", "sub"} {
+		if err := os.Chtimes(filepath.Join(src, filepath.FromSlash(name)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := encryptDir(buf, src, key); err != nil {
+		t.Fatal(err)
+	}
+	if (buf.Len()-headerLen)%archiveSealed != 0 {
+		t.Fatal("wrong encrypted archive len")
+	}
+
+	extract := func(enc []byte) (string, error) {
+		dst := filepath.Join(t.TempDir(), "out")
+		r := bytes.NewReader(enc)
+		h, err := readHeader(r)
+		if err != nil {
+			return dst, err
+		}
+		cipr, err := openArchive(r, key, h)
+		if err != nil {
+			return dst, err
+		}
+		return dst, extractTar(cipr, dst, false)
+	}
+
+	dst, err := extract(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string][]byte{
+		"small":        []byte("plain-text"),
+		"sub/deep/big": big,
+		"sub/empty":    {},
+		"link":         []byte("plain-text"),
+	} {
+		bf, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bf, want) {
+			t.Fatalf("%s: extracted data is not same as plaintext", name)
+		}
+	}
+
+	if info, err := os.Stat(filepath.Join(dst, "small")); err != nil || info.Mode().Perm() != 0640 {
+		t.Fatal("file mode is not restored")
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "link")); err != nil || link != "small" {
+		t.Fatal("symlink is not restored")
+	}
+	if info, err := os.Stat(filepath.Join(dst, "sub")); err != nil || info.Mode().Perm() != 0750 {
+		t.Fatal("directory mode is not restored")
+	}
+	for _, name := range []string{"small", "sub/deep/big", "sub/deep", "sub"} {
+		info, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || !info.ModTime().Equal(mtime) {
+			t.Fatalf("%s: modification time is not restored", name)
+		}
+	}
+
+	// corrupted chunk and truncated archive must be detected
+	enc := append([]byte{}, buf.Bytes()...)
+	enc[headerLen+archiveSealed+8] ^= 0x01
+	if _, err := extract(enc); !errors.Is(err, rabaead.ErrAuthMsg) {
+		t.Fatal("err auth must returned")
+	}
+
+	if _, err := extract(buf.Bytes()[:buf.Len()-archiveSealed]); err == nil {
+		t.Fatal("truncated archive must not be extracted")
+	}
+}
+
+func TestExtractPath(t *testing.T) {
+	dst := t.TempDir()
+	for _, name := range []string{"../x", "/etc/passwd", "a/../../x", "", "./"} {
+		if _, err := extractPath(dst, name); err != errUnsafePath {
+			t.Fatalf("%q: err unsafe path must returned", name)
+		}
+	}
+
+	os.Symlink("/tmp", filepath.Join(dst, "link"))
+	if _, err := extractPath(dst, "link/x"); err != errUnsafePath {
+		t.Fatal("writing through symlink must be rejected")
+	}
+	if _, err := extractPath(dst, "a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+
+	// directory entry over a symlink extracted before it must not touch link target
+	outside := t.TempDir()
+	os.Chmod(outside, 0700)
+	before, _ := os.Stat(outside)
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "a", Linkname: outside})
+	tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: "a/", Mode: 0777, ModTime: time.Unix(0, 0)})
+	tw.Close()
+
+	if err := extractTar(buf, filepath.Join(dst, "out"), false); !errors.Is(err, errUnsafePath) {
+		t.Fatal("directory entry over symlink must be rejected", err)
+	}
+	after, _ := os.Stat(outside)
+	if after.Mode() != before.Mode() || !after.ModTime().Equal(before.ModTime()) {
+		t.Fatal("symlink target must not be changed")
+	}
+}
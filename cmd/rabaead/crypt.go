@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabaead"
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+// encrypted file: header || chunks sealed with chunkWriter in counter mode and
+// NewSubkeyAEAD, header is used as AD of every chunk.
+// header: magic (7byte) || version (1byte) || mode (1byte) || nonce (8byte).
+// version 1 sealed single files with streamWriter, its poly1305 key is keystream of
+// first 32 bytes of plaintext, so known plaintext allows forgery. it is not supported
+const (
+	fileMagic    = "rabaead"
+	fileVersion  = 0x02
+	modeStream   = 0x01 // a single file or stdin
+	streamChunk  = 0x1000
+	streamSealed = 2 + streamChunk + poly1305.TagSize
+	headerLen    = len(fileMagic) + 2 + rabbitio.IVXLen
+)
+
+var errBadHeader = errors.New("not a rabaead encrypted file or unsupported version")
+
+type fileHeader struct {
+	version byte
+	mode    byte
+	nonce   []byte
+}
+
+func newHeader(mode byte) (fileHeader, error) {
+	h := fileHeader{version: fileVersion, mode: mode, nonce: make([]byte, rabbitio.IVXLen)}
+	_, err := io.ReadFull(rand.Reader, h.nonce)
+	return h, err
+}
+
+func (h fileHeader) marshal() []byte {
+	b := make([]byte, 0, headerLen)
+	b = append(b, fileMagic...)
+	b = append(b, h.version, h.mode)
+	return append(b, h.nonce...)
+}
+
+func readHeader(r io.Reader) (fileHeader, error) {
+	b := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fileHeader{}, errBadHeader
+		}
+		return fileHeader{}, err
+	}
+
+	if !bytes.Equal(b[:len(fileMagic)], []byte(fileMagic)) || b[len(fileMagic)] != fileVersion {
+		return fileHeader{}, errBadHeader
+	}
+
+	return fileHeader{
+		version: b[len(fileMagic)],
+		mode:    b[len(fileMagic)+1],
+		nonce:   b[len(fileMagic)+2:],
+	}, nil
+}
+
+// encryptTo writes header and sealed data of r to w
+func encryptTo(w io.Writer, r io.Reader, key []byte, mode byte) error {
+	h, err := newHeader(mode)
+	if err != nil {
+		return err
+	}
+
+	cw, err := sealChunks(w, key, h, streamChunk)
+	if err != nil {
+		return err
+	}
+
+	// chunk writer collects reads of r into full chunks
+	if _, err := io.Copy(cw, r); err != nil {
+		return err
+	}
+
+	// write last chunk and final chunk, w is not closed
+	return cw.Close()
+}
+
+// openStream returns a reader of opened data after header h of r, each chunk is
+// authenticated before it is returned, whole data is authenticated at EOF
+func openStream(r io.Reader, key []byte, h fileHeader) (io.Reader, error) {
+	return openChunks(r, key, h, streamChunk)
+}
+
+// sealChunks writes header h to w and returns a counter mode chunk writer on w,
+// with header as AD of every chunk
+func sealChunks(w io.Writer, key []byte, h fileHeader, chunk int) (io.WriteCloser, error) {
+	head := h.marshal()
+	if _, err := w.Write(head); err != nil {
+		return nil, err
+	}
+
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// hide Close method of w, chunkWriter closes underlying writer
+	cw, err := rabaead.NewChunkWriter(struct{ io.Writer }{w}, chunk, aead, h.nonce, func() []byte { return head })
+	if err != nil {
+		return nil, err
+	}
+	cw.SetCounter(true)
+	return cw, nil
+}
+
+// openChunks returns a reader of counter mode chunks after header h of r
+func openChunks(r io.Reader, key []byte, h fileHeader, chunk int) (io.Reader, error) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	head := h.marshal()
+	cr, err := rabaead.NewChunkReader(r, chunk, aead, h.nonce, func() []byte { return head })
+	if err != nil {
+		return nil, err
+	}
+	cr.SetCounter(true)
+	return cr, nil
+}
+
+func encrypt(flagset *flag.FlagSet, args []string) error {
+	keys := addKeyFlags(flagset)
+	out := flagset.String("out", "", "encrypted output file, stdout if not set or \"-\"")
+	flagset.Parse(args)
+	if flagset.NArg() > 1 {
+		return errUsage
+	}
+
+	key, err := keys.load()
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(flagset.Arg(0)); err == nil && info.IsDir() {
+		return writeOutput(*out, 0600, func(w io.Writer) error {
+			return encryptDir(w, flagset.Arg(0), key)
+		})
+	}
+
+	in, perm, err := openInput(flagset.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeOutput(*out, perm, func(w io.Writer) error {
+		return encryptTo(w, in, key, modeStream)
+	})
+}
+
+func decrypt(flagset *flag.FlagSet, args []string) error {
+	keys := addKeyFlags(flagset)
+	out := flagset.String("out", "", "decrypted output file, stdout if not set or \"-\". "+
+		"file output is only renamed into place after data is authenticated, "+
+		"stdout receives data before it is authenticated. "+
+		"archives are extracted into -out directory")
+	verbose := flagset.Bool("v", false, "print names of extracted archive entries")
+	flagset.Parse(args)
+	if flagset.NArg() > 1 {
+		return errUsage
+	}
+
+	key, err := keys.load()
+	if err != nil {
+		return err
+	}
+
+	in, perm, err := openInput(flagset.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	h, err := readHeader(in)
+	if err != nil {
+		return err
+	}
+
+	switch h.mode {
+	case modeStream:
+		cipr, err := openStream(in, key, h)
+		if err != nil {
+			return err
+		}
+		return writeOutput(*out, perm, func(w io.Writer) error {
+			_, err := io.Copy(w, cipr)
+			return err
+		})
+
+	case modeArchive:
+		if *out == "" || *out == "-" {
+			return fmt.Errorf("archive must be extracted into a directory: %w", errUsage)
+		}
+		cipr, err := openArchive(in, key, h)
+		if err != nil {
+			return err
+		}
+		return extractTar(cipr, *out, *verbose)
+	}
+
+	return fmt.Errorf("unknown mode %#x: %w", h.mode, errBadHeader)
+}
+
+func inspect(flagset *flag.FlagSet, args []string) error {
+	flagset.Parse(args)
+	if flagset.NArg() > 1 {
+		return errUsage
+	}
+
+	in, _, err := openInput(flagset.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	h, err := readHeader(in)
+	if err != nil {
+		return err
+	}
+
+	size, err := io.Copy(io.Discard, in)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version:    %d\n", h.version)
+	fmt.Printf("mode:       %s\n", modeName(h.mode))
+	fmt.Printf("nonce:      %x\n", h.nonce)
+	fmt.Printf("ciphertext: %d bytes\n", size)
+
+	chunk := streamChunk
+	if h.mode == modeArchive {
+		chunk = archiveChunk
+	}
+	sealed := int64(2 + chunk + poly1305.TagSize)
+	fmt.Printf("chunks:     %d of %d bytes\n", size/sealed, chunk)
+	if size%sealed != 0 {
+		return errors.New("truncated file, last chunk is incomplete")
+	}
+	if size == 0 {
+		return errors.New("truncated file, final chunk is missing")
+	}
+	fmt.Printf("plaintext:  at most %d bytes\n", (size/sealed-1)*int64(chunk))
+	return nil
+}
+
+func modeName(mode byte) string {
+	switch mode {
+	case modeStream:
+		return "stream"
+	case modeArchive:
+		return "archive"
+	}
+	return fmt.Sprintf("unknown (%#x)", mode)
+}
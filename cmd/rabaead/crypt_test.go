@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+var key = []byte{
+	0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff,
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	plain := bytes.Repeat([]byte("plain-text"), 500)
+	buf := &bytes.Buffer{}
+	if err := encryptTo(buf, bytes.NewReader(plain), key, modeStream); err != nil {
+		t.Fatal(err)
+	}
+
+	// two data chunks and final chunk
+	if buf.Len() != headerLen+3*streamSealed {
+		t.Fatal("wrong encrypted file len")
+	}
+
+	cipr, h, err := decryptFrom(bytes.NewReader(buf.Bytes()), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.mode != modeStream {
+		t.Fatal("wrong file mode")
+	}
+
+	bf, err := io.ReadAll(cipr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bf, plain) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+
+	// tampered chunk
+	enc := append([]byte{}, buf.Bytes()...)
+	enc[headerLen+streamSealed+8] ^= 0x01
+	cipr, _, _ = decryptFrom(bytes.NewReader(enc), key)
+	if _, err := io.ReadAll(cipr); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for tampered chunk")
+	}
+
+	// version 1 files are not supported
+	enc = append([]byte{}, buf.Bytes()...)
+	enc[len(fileMagic)] = 0x01
+	if _, _, err := decryptFrom(bytes.NewReader(enc), key); err != errBadHeader {
+		t.Fatal("err bad header must returned for version 1")
+	}
+
+	// header is authenticated as additional data
+	enc = buf.Bytes()
+	enc[len(fileMagic)+1] = 0x7f
+	cipr, _, err = decryptFrom(bytes.NewReader(enc), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(cipr); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+
+	if _, _, err := decryptFrom(bytes.NewReader(enc[:headerLen-1]), key); err != errBadHeader {
+		t.Fatal("err bad header must returned")
+	}
+}
+
+func decryptFrom(r io.Reader, key []byte) (io.Reader, fileHeader, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, h, err
+	}
+	cipr, err := openStream(r, key, h)
+	return cipr, h, err
+}
+
+func TestParseKey(t *testing.T) {
+	for _, in := range []string{"ffffffffffffffffffffffffffffffff", " ffffffffffffffffffffffffffffffff\n", string(key)} {
+		k, err := parseKey([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(k, key) {
+			t.Fatal("wrong parsed key")
+		}
+	}
+
+	if _, err := parseKey([]byte("fffff")); err == nil {
+		t.Fatal("short key must be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+const defaultKeyEnv = "RABAEAD_KEY"
+
+var errUsage = errors.New("bad usage, run help for more information")
+
+type keyFlags struct {
+	file *string
+	env  *string
+}
+
+func addKeyFlags(flagset *flag.FlagSet) keyFlags {
+	return keyFlags{
+		file: flagset.String("key-file", "", "file containing rabbit key, 32 hex characters or 16 raw bytes"),
+		env:  flagset.String("key-env", defaultKeyEnv, "environment variable containing rabbit key, if -key-file is not set"),
+	}
+}
+
+// load reads key from key file, or from environment variable
+func (k keyFlags) load() ([]byte, error) {
+	if *k.file != "" {
+		b, err := os.ReadFile(*k.file)
+		if err != nil {
+			return nil, err
+		}
+		return parseKey(b)
+	}
+
+	v, ok := os.LookupEnv(*k.env)
+	if !ok || v == "" {
+		return nil, fmt.Errorf("no key: set -key-file or %s environment variable", *k.env)
+	}
+	return parseKey([]byte(v))
+}
+
+// parseKey accepts 16 raw bytes, or 32 hex characters with surrounding spaces
+func parseKey(b []byte) ([]byte, error) {
+	if len(b) == rabbitio.KeyLen {
+		return b, nil
+	}
+
+	b = bytes.TrimSpace(b)
+	key := make([]byte, hex.DecodedLen(len(b)))
+	if _, err := hex.Decode(key, b); err != nil || len(key) != rabbitio.KeyLen {
+		return nil, rabbitio.ErrInvalidKey
+	}
+	return key, nil
+}
+
+func keygen(flagset *flag.FlagSet, args []string) error {
+	out := flagset.String("out", "", "key file to write, stdout if not set or \"-\"")
+	flagset.Parse(args)
+	if flagset.NArg() != 0 {
+		return errUsage
+	}
+
+	key := make([]byte, rabbitio.KeyLen)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+
+	text := []byte(hex.EncodeToString(key) + "\n")
+	if *out == "" || *out == "-" {
+		_, err := os.Stdout.Write(text)
+		return err
+	}
+
+	return writeAtomic(*out, 0600, func(w io.Writer) error {
+		_, err := w.Write(text)
+		return err
+	})
+}
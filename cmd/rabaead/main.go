@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// exit codes
+const (
+	exitOK    = 0x00
+	exitError = 0x01
+	exitUsage = 0x02
+	exitAuth  = 0x03 // ciphertext is not authentic, ErrAuthMsg
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = flagUsage
+	if len(os.Args) < 2 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "encrypt":
+		err = encrypt(flag.NewFlagSet("encrypt", flag.ExitOnError), os.Args[2:])
+	case "decrypt":
+		err = decrypt(flag.NewFlagSet("decrypt", flag.ExitOnError), os.Args[2:])
+	case "keygen":
+		err = keygen(flag.NewFlagSet("keygen", flag.ExitOnError), os.Args[2:])
+	case "inspect":
+		err = inspect(flag.NewFlagSet("inspect", flag.ExitOnError), os.Args[2:])
+	case "tunnel":
+		err = tunnel(flag.NewFlagSet("tunnel", flag.ExitOnError), os.Args[2:])
+	case "secrets":
+		err = editSecrets(flag.NewFlagSet("secrets", flag.ExitOnError), os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		flag.Usage()
+		os.Exit(exitOK)
+	default:
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	os.Exit(exitCode(err))
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, rabaead.ErrAuthMsg):
+		log.Print(err)
+		return exitAuth
+	case errors.Is(err, errUsage):
+		log.Print(err)
+		return exitUsage
+	}
+	log.Print(err)
+	return exitError
+}
+
+func flagUsage() {
+	fmt.Fprintf(os.Stderr, `usage of %v: commands <args...|help>
+commands:
+
+   encrypt <args...> [path]   encrypt file, directory or stdin with rabbit poly1305 aead cipher
+   decrypt <args...> [file]   decrypt file or stdin, archives are extracted into -out directory
+   keygen  <args...>          generate a random 16-byte rabbit key
+   inspect [file]             print header and sizes of an encrypted file
+   tunnel  <args...>          forward tcp connections through an encrypted tunnel
+   secrets <encrypt|decrypt> <args...> [file]
+                              encrypt or decrypt values of a yaml, json or env secrets file
+
+key is read from -key-file, or from environment variable named by -key-env
+(default %s), as 32 hex characters or 16 raw bytes. output is written to
+-out atomically, or to stdout if -out is not set or is "-".
+
+exit codes: 0 success, 1 error, 2 bad usage, 3 message authentication failed
+
+
+Copyright (c) 2022 snix.ir, All rights reserved.
+Developed BY <Sina Ghaderi> sina@snix.ir
+This work is licensed under the terms of GNU General Public license.
+Github: github.com/sina-ghaderi and Source: git.snix.ir
+`, os.Args[0], defaultKeyEnv)
+}
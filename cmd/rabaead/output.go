@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeAtomic writes to a temp file next to name, then renames it to name.
+// if write fails, temp file is removed and name is left untouched
+func writeAtomic(name string, perm os.FileMode, write func(io.Writer) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	if err := writeTemp(temp, perm, write); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	if err := os.Rename(temp.Name(), name); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return nil
+}
+
+func writeTemp(temp *os.File, perm os.FileMode, write func(io.Writer) error) error {
+	defer temp.Close()
+	if err := write(temp); err != nil {
+		return err
+	}
+
+	if err := temp.Chmod(perm); err != nil {
+		return err
+	}
+
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+	return temp.Close()
+}
+
+// openInput opens name for reading, stdin if name is empty or "-"
+func openInput(name string) (io.ReadCloser, os.FileMode, error) {
+	if name == "" || name == "-" {
+		return io.NopCloser(os.Stdin), 0644, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Mode().Perm(), nil
+}
+
+// writeOutput writes to stdout if name is empty or "-", otherwise to name atomically
+func writeOutput(name string, perm os.FileMode, write func(io.Writer) error) error {
+	if name == "" || name == "-" {
+		return write(os.Stdout)
+	}
+	return writeAtomic(name, perm, write)
+}
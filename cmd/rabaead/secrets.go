@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/sina-ghaderi/rabaead/secrets"
+)
+
+// editSecrets encrypts or decrypts values of a yaml, json or env secrets file, keys and
+// comments stay readable. services load encrypted file with secrets.LoadFile
+func editSecrets(flagset *flag.FlagSet, args []string) error {
+	keys := addKeyFlags(flagset)
+	out := flagset.String("out", "", "output file, stdout if not set or \"-\", may be the input file itself")
+	format := flagset.String("format", "", "file format: yaml, json or env, detected from file extension if not set")
+	if len(args) == 0 {
+		return errUsage
+	}
+	action := args[0]
+	flagset.Parse(args[1:])
+	if flagset.NArg() > 1 {
+		return errUsage
+	}
+
+	var transform func([]byte, secrets.Format, []byte) ([]byte, error)
+	switch action {
+	case "encrypt":
+		transform = secrets.Encrypt
+	case "decrypt":
+		transform = secrets.Decrypt
+	default:
+		return errUsage
+	}
+
+	name := flagset.Arg(0)
+	var f secrets.Format
+	var err error
+	switch {
+	case *format != "":
+		f, err = secrets.ParseFormat(*format)
+	case name == "" || name == "-":
+		return fmt.Errorf("-format is required for stdin: %w", errUsage)
+	default:
+		f, err = secrets.FormatOf(name)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %w", err, errUsage)
+	}
+
+	key, err := keys.load()
+	if err != nil {
+		return err
+	}
+
+	in, perm, err := openInput(name)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(in)
+	in.Close()
+	if err != nil {
+		return err
+	}
+
+	res, err := transform(data, f, key)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, perm, func(w io.Writer) error {
+		_, err := w.Write(res)
+		return err
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead/secrets"
+)
+
+func TestSecrets(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	name := filepath.Join(dir, ".env")
+	os.WriteFile(keyFile, []byte(hex.EncodeToString(key)), 0600)
+	os.WriteFile(name, []byte("TOKEN=secret\n"), 0600)
+
+	run := func(args ...string) error {
+		return editSecrets(flag.NewFlagSet("secrets", flag.ContinueOnError), args)
+	}
+	if err := run("encrypt", "-key-file", keyFile, "-out", name, name); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(name)
+	if !strings.HasPrefix(string(b), "TOKEN=rabaead:") {
+		t.Fatalf("value must be encrypted in place: %s", b)
+	}
+
+	m, err := secrets.LoadFile(name, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["TOKEN"] != "secret" {
+		t.Fatal("loaded secret mismatch")
+	}
+
+	if err := run("rotate", name); !errors.Is(err, errUsage) {
+		t.Fatal("err usage must returned for unknown action")
+	}
+	if err := run("decrypt", "-key-file", keyFile); !errors.Is(err, errUsage) {
+		t.Fatal("err usage must returned for stdin without format")
+	}
+}
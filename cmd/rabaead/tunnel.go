@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sina-ghaderi/rabaead"
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+// tunnel handshake: client sends its nonce, server sends its nonce, client proves
+// knowledge of key with hmac of both nonces, server dials backend only after that.
+// server then proves knowledge of key with hmac of its own label, so client never
+// forwards data to a peer without the key.
+// each direction has its own key derived from both nonces, so recorded sessions can
+// not be replayed and data can not be reflected back to its sender. traffic is sealed
+// with chunkWriter in counter mode, end of each direction is its final chunk
+const (
+	tunnelChunk    = 0x0800
+	tunnelTimeout  = 10 * time.Second
+	tunnelConfirm  = sha256.Size
+	tunnelUpload   = "rabaead tunnel client to server"
+	tunnelDownload = "rabaead tunnel server to client"
+	tunnelProof    = "rabaead tunnel client proof"
+	tunnelSrvProof = "rabaead tunnel server proof"
+)
+
+var errHandshake = errors.New("tunnel handshake failed, wrong key or not a rabaead tunnel")
+
+// tunnelStream is one side of an encrypted tunnel connection
+type tunnelStream struct {
+	conn net.Conn
+	r    io.Reader
+	w    io.WriteCloser
+}
+
+func tunnel(flagset *flag.FlagSet, args []string) error {
+	keys := addKeyFlags(flagset)
+	listen := flagset.String("listen", "127.0.0.1:7899", "network tcp listen address")
+	connect := flagset.String("connect", "", "network tcp address to forward connections to, "+
+		"tunnel server on client side and backend service on server side")
+	server := flagset.Bool("server", false, "run server side, accept encrypted connections "+
+		"and forward them as plaintext to -connect")
+	chunk := flagset.Int("chunk", tunnelChunk, "max chunk size, each read is sealed as a chunk of this size. "+
+		"it must be the same on client and server side")
+	flagset.Parse(args)
+	if flagset.NArg() != 0 || *connect == "" || *chunk <= 0 || *chunk > 0xffff {
+		return errUsage
+	}
+
+	key, err := keys.load()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return serveTunnel(l, *connect, key, *server, *chunk)
+}
+
+// serveTunnel accepts connections from l and forwards them to target until l is closed.
+// other accept errors, like too many open files, are retried with backoff like http.Server
+func serveTunnel(l net.Listener, target string, key []byte, server bool, chunk int) error {
+	var delay time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			if delay *= 2; delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay > time.Second {
+				delay = time.Second
+			}
+			log.Printf("accept: %v, retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		if server {
+			go tunnelServer(conn, target, key, chunk)
+		} else {
+			go tunnelClient(conn, target, key, chunk)
+		}
+	}
+}
+
+// tunnelClient forwards plaintext conn to tunnel server at target
+func tunnelClient(plain net.Conn, target string, key []byte, chunk int) {
+	defer plain.Close()
+	conn, err := net.DialTimeout("tcp", target, tunnelTimeout)
+	if err != nil {
+		log.Printf("%s: %v", plain.RemoteAddr(), err)
+		return
+	}
+	defer conn.Close()
+
+	s, err := newTunnelStream(conn, key, false, chunk)
+	if err != nil {
+		log.Printf("%s: %v", target, err)
+		return
+	}
+
+	if err := pipeTunnel(plain, s); err != nil {
+		log.Printf("%s: %v", plain.RemoteAddr(), err)
+	}
+}
+
+// tunnelServer forwards encrypted conn to backend at target
+func tunnelServer(conn net.Conn, target string, key []byte, chunk int) {
+	defer conn.Close()
+	s, err := newTunnelStream(conn, key, true, chunk)
+	if err != nil {
+		log.Printf("%s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	plain, err := net.DialTimeout("tcp", target, tunnelTimeout)
+	if err != nil {
+		log.Printf("%s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer plain.Close()
+
+	if err := pipeTunnel(plain, s); err != nil {
+		log.Printf("%s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// newTunnelStream runs handshake on conn and returns its sealed streams
+func newTunnelStream(conn net.Conn, key []byte, server bool, chunk int) (*tunnelStream, error) {
+	conn.SetDeadline(time.Now().Add(tunnelTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	own := make([]byte, rabbitio.IVXLen)
+	peer := make([]byte, rabbitio.IVXLen)
+	if _, err := io.ReadFull(rand.Reader, own); err != nil {
+		return nil, err
+	}
+
+	cnon, snon := own, peer
+	if server {
+		cnon, snon = peer, own
+		if _, err := io.ReadFull(conn, peer); err != nil {
+			return nil, errHandshake
+		}
+	}
+
+	if _, err := conn.Write(own); err != nil {
+		return nil, err
+	}
+
+	if !server {
+		if _, err := io.ReadFull(conn, peer); err != nil {
+			return nil, errHandshake
+		}
+	}
+
+	// client proves key first, server proves key after verifying client
+	send, want := tunnelKey(key, tunnelProof, cnon, snon), tunnelKey(key, tunnelSrvProof, cnon, snon)
+	if server {
+		send, want = want, send
+		if err := readProof(conn, want); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := conn.Write(send); err != nil {
+		return nil, err
+	}
+	if !server {
+		if err := readProof(conn, want); err != nil {
+			return nil, err
+		}
+	}
+
+	wkey, rkey := tunnelKey(key, tunnelUpload, cnon, snon), tunnelKey(key, tunnelDownload, cnon, snon)
+	wnon, rnon := cnon, snon
+	if server {
+		wkey, rkey = rkey, wkey
+		wnon, rnon = rnon, wnon
+	}
+
+	waead, err := rabaead.NewSubkeyAEAD(wkey[:rabbitio.KeyLen])
+	if err != nil {
+		return nil, err
+	}
+	raead, err := rabaead.NewSubkeyAEAD(rkey[:rabbitio.KeyLen])
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := rabaead.NewChunkWriter(halfCloser{conn}, chunk, waead, wnon, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := rabaead.NewChunkReader(conn, chunk, raead, rnon, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w.SetCounter(true)
+	r.SetCounter(true)
+	return &tunnelStream{conn: conn, r: r, w: w}, nil
+}
+
+// readProof reads peer proof from conn and compares it with want
+func readProof(conn net.Conn, want []byte) error {
+	b := make([]byte, tunnelConfirm)
+	if _, err := io.ReadFull(conn, b); err != nil || !hmac.Equal(b, want) {
+		return errHandshake
+	}
+	return nil
+}
+
+// tunnelKey returns hmac-sha256 of label and both nonces with key
+func tunnelKey(key []byte, label string, cnon, snon []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	mac.Write(cnon)
+	mac.Write(snon)
+	return mac.Sum(nil)
+}
+
+// pipeTunnel copies data in both directions until both sides are done. end of data in
+// one direction is forwarded as a half close, so protocols relying on it keep working
+func pipeTunnel(plain net.Conn, s *tunnelStream) error {
+	var wg sync.WaitGroup
+	var upErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// hide ReadFrom of chunk writer, each read is sealed without waiting for a full chunk
+		if _, upErr = io.Copy(struct{ io.Writer }{s.w}, plain); upErr == nil {
+			upErr = s.w.Close() // final chunk and half close
+		}
+		if upErr != nil {
+			s.conn.Close()
+		}
+	}()
+
+	_, err := io.Copy(plain, s.r)
+	if err == nil {
+		err = halfCloser{plain}.Close()
+	}
+	if err != nil {
+		plain.Close() // unblock upload, connection is broken
+	}
+
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return upErr
+}
+
+// halfCloser closes write side of a connection only, if it supports that
+type halfCloser struct{ net.Conn }
+
+func (h halfCloser) Close() error {
+	if c, ok := h.Conn.(interface{ CloseWrite() error }); ok {
+		return c.CloseWrite()
+	}
+	return nil
+}
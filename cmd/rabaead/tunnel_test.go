@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+func listenLocal(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestTunnel(t *testing.T) {
+	// echo backend, replies after client half closes
+	backend := listenLocal(t)
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				bf, _ := io.ReadAll(conn)
+				conn.Write(bf)
+			}()
+		}
+	}()
+
+	server, client := listenLocal(t), listenLocal(t)
+	go serveTunnel(server, backend.Addr().String(), key, true, 0x10)
+	go serveTunnel(client, server.Addr().String(), key, false, 0x10)
+
+	conn, err := net.Dial("tcp", client.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	plain := bytes.Repeat([]byte("plain-text"), 100)
+	if _, err := conn.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+
+	bf, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bf, plain) {
+		t.Fatal("tunneled data is not same as plaintext")
+	}
+}
+
+func TestTunnelHandshake(t *testing.T) {
+	l := listenLocal(t)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		newTunnelStream(conn, bytes.Repeat([]byte{0x01}, 16), false, 0x10)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := newTunnelStream(conn, key, true, 0x10); err != errHandshake {
+		t.Fatal("err handshake must returned")
+	}
+}
+
+func TestTunnelServerProof(t *testing.T) {
+	// fake server without key, reflects client proof back to client
+	l := listenLocal(t)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		non := make([]byte, rabbitio.IVXLen)
+		if _, err := io.ReadFull(conn, non); err != nil {
+			return
+		}
+		conn.Write(non)
+		proof := make([]byte, tunnelConfirm)
+		if _, err := io.ReadFull(conn, proof); err != nil {
+			return
+		}
+		conn.Write(proof)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := newTunnelStream(conn, key, false, 0x10); err != errHandshake {
+		t.Fatal("err handshake must returned")
+	}
+}
+
+func TestTunnelInteractive(t *testing.T) {
+	// echo backend, replies to each read
+	backend := listenLocal(t)
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	server, client := listenLocal(t), listenLocal(t)
+	go serveTunnel(server, backend.Addr().String(), key, true, 0x10)
+	go serveTunnel(client, server.Addr().String(), key, false, 0x10)
+
+	conn, err := net.Dial("tcp", client.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// data shorter than a chunk must be forwarded without waiting for more
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	bf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, bf); err != nil || string(bf) != "ping" {
+		t.Fatal("short write must be forwarded", err)
+	}
+}
+
+// failListener fails accept with err n times, then reports a closed listener
+type failListener struct {
+	net.Listener
+	err error
+	n   int
+}
+
+func (l *failListener) Accept() (net.Conn, error) {
+	if l.n == 0 {
+		return nil, net.ErrClosed
+	}
+	l.n--
+	return nil, l.err
+}
+
+func TestServeTunnelAccept(t *testing.T) {
+	l := &failListener{err: errors.New("too many open files"), n: 2}
+	if err := serveTunnel(l, "", key, true, 0x10); !errors.Is(err, net.ErrClosed) || l.n != 0 {
+		t.Fatal("accept errors must be retried until listener is closed")
+	}
+}
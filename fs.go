@@ -0,0 +1,425 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+// encrypted fs file: nonce (8byte) || chunks sealed with chunkWriter in counter mode.
+// file key is sha256(key || nonce) and file name is additional data of every chunk,
+// so files can not be swapped or renamed. every chunk but the last data chunk is full,
+// so plaintext size and offsets are computed from the chunk layout
+const (
+	FSChunk  = 0x4000 // plaintext chunk size of encrypted fs files
+	fsNonce  = rabbitio.IVXLen
+	fsSealed = cmrs + FSChunk + poly1305.TagSize
+)
+
+var ErrFSFile = errors.New("rabaead: encrypted file is truncated or does not support random access")
+
+type encryptedFS struct {
+	fsys fs.FS
+	key  []byte
+}
+
+type encryptedFile struct {
+	file   fs.File
+	rat    io.ReaderAt
+	info   fs.FileInfo // underlying file info
+	aead   cipher.AEAD
+	name   []byte     // additional data
+	cnon   []byte     // reused counter nonce
+	cadd   []byte     // reused counter additional data
+	size   int64      // plaintext size
+	chunks int64      // data chunks, final chunk excluded
+	offset int64      // Read and Seek offset
+	mutex  sync.Mutex // guards buffers below and rat, ReadAt may be called in parallel
+	chnk   []byte     // reused sealed chunk buffer
+	plin   []byte     // opened chunk buffer
+	cidx   int64      // index of opened chunk in plin, -1 if none
+	cbuf   []byte     // plaintext of opened chunk, a view into plin
+}
+
+type encryptedDir struct {
+	fs.ReadDirFile
+	efs  *encryptedFS
+	name string
+}
+
+type encryptedEntry struct {
+	fs.DirEntry
+	efs  *encryptedFS
+	name string
+}
+
+type encryptedInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+type fsWriter struct {
+	cw   *chunkWriter
+	buff []byte
+	n    int
+}
+
+// NewEncryptedFS returns encryptedFS data type, which implements fs.FS on top of fsys
+// of encrypted files written by NewFSWriter or EncryptFS. opened files are decrypted
+// on read and implement io.Seeker and io.ReaderAt, Stat reports plaintext sizes.
+// each read chunk is authenticated before it is returned, corrupted chunks are
+// reported as ErrAuthMsg. underlying files must implement io.ReaderAt or io.Seeker
+func NewEncryptedFS(fsys fs.FS, key []byte) (*encryptedFS, error) {
+	if len(key) != rabbitio.KeyLen {
+		return nil, rabbitio.ErrInvalidKey
+	}
+
+	e := &encryptedFS{fsys: fsys, key: make([]byte, rabbitio.KeyLen)}
+	copy(e.key, key)
+	return e, nil
+}
+
+// NewFSWriter returns a writer of encrypted fs file with name, name is the path
+// of file in fs, as it is passed to Open. running Close() is necessary in order
+// to write last chunk and final chunk, underlying writer is not closed
+func NewFSWriter(w io.Writer, key []byte, name string) (io.WriteCloser, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+
+	nonce := make([]byte, fsNonce)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	a, err := derivedAEAD(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(nonce); err != nil {
+		return nil, err
+	}
+
+	ad := []byte(name)
+	cw, err := NewChunkWriter(struct{ io.Writer }{w}, FSChunk, a, nil, func() []byte { return ad })
+	if err != nil {
+		return nil, err
+	}
+	cw.SetCounter(true)
+	return &fsWriter{cw: cw, buff: make([]byte, FSChunk)}, nil
+}
+
+// EncryptFS writes every regular file of src encrypted into directory dir,
+// with the same relative path. dir can be served with NewEncryptedFS(os.DirFS(dir))
+func EncryptFS(dir string, src fs.FS, key []byte) error {
+	return fs.WalkDir(src, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return encryptFSFile(dst, src, key, name)
+	})
+}
+
+func encryptFSFile(dst string, src fs.FS, key []byte, name string) error {
+	in, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	w, err := NewFSWriter(out, key, name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// Write buffers plaintext and seals it in full chunks
+func (w *fsWriter) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		s := copy(w.buff[w.n:], b)
+		w.n += s
+		b = b[s:]
+		n += s
+
+		if w.n == len(w.buff) {
+			if _, err := w.cw.Write(w.buff); err != nil {
+				return n, err
+			}
+			w.n = 0
+		}
+	}
+	return n, nil
+}
+
+// Close seals last buffered chunk and writes final chunk
+func (w *fsWriter) Close() error {
+	if w.n > 0 {
+		if _, err := w.cw.Write(w.buff[:w.n]); err != nil {
+			return err
+		}
+		w.n = 0
+	}
+	return w.cw.Close()
+}
+
+// Open opens named encrypted file or directory, files are authenticated
+// to be complete and to belong to name before they are returned
+func (e *encryptedFS) Open(name string) (fs.File, error) {
+	file, err := e.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		d, ok := file.(fs.ReadDirFile)
+		if !ok {
+			file.Close()
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not implemented")}
+		}
+		return &encryptedDir{ReadDirFile: d, efs: e, name: name}, nil
+	}
+
+	f, err := e.openFile(file, info, name)
+	if err != nil {
+		file.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return f, nil
+}
+
+func (e *encryptedFS) openFile(file fs.File, info fs.FileInfo, name string) (*encryptedFile, error) {
+	rat, ok := file.(io.ReaderAt)
+	if !ok {
+		s, ok := file.(io.ReadSeeker)
+		if !ok {
+			return nil, ErrFSFile
+		}
+		rat = &seekReaderAt{s}
+	}
+
+	body := info.Size() - fsNonce
+	if body < fsSealed || body%fsSealed != 0 {
+		return nil, ErrFSFile
+	}
+
+	nonce := make([]byte, fsNonce)
+	if _, err := rat.ReadAt(nonce, 0); err != nil {
+		return nil, ErrFSFile
+	}
+
+	a, err := derivedAEAD(e.key, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &encryptedFile{
+		file:   file,
+		rat:    rat,
+		info:   info,
+		aead:   a,
+		name:   []byte(name),
+		cnon:   make([]byte, rabbitio.IVXLen),
+		chunks: body/fsSealed - 1,
+		chnk:   make([]byte, fsSealed),
+		plin:   make([]byte, fsSealed),
+		cidx:   -1,
+	}
+
+	// final chunk proves the file is not truncated,
+	// last data chunk gives plaintext size
+	if _, err := f.open(f.chunks, true); err != nil {
+		return nil, err
+	}
+	if f.chunks > 0 {
+		if err := f.load(f.chunks - 1); err != nil {
+			return nil, err
+		}
+		f.size = (f.chunks-1)*FSChunk + int64(len(f.cbuf))
+	}
+	return f, nil
+}
+
+// open reads and opens sealed chunk i into plin
+func (f *encryptedFile) open(i int64, final bool) ([]byte, error) {
+	if n, err := f.rat.ReadAt(f.chnk, fsNonce+i*fsSealed); n < len(f.chnk) {
+		if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrFSFile
+		}
+		return nil, err
+	}
+
+	nonce := chunkNonce(f.cnon, nil, uint64(i), final)
+	f.cadd = append(append(f.cadd[:0], f.name...), nonce...)
+	ptxt, err := f.aead.Open(f.plin[:0], nonce, f.chnk, f.cadd)
+	if err != nil {
+		f.cidx = -1
+		return nil, err
+	}
+
+	n := int(binary.LittleEndian.Uint16(ptxt[0:cmrs]))
+	if n > FSChunk || final && n != 0 {
+		f.cidx = -1
+		return nil, ErrAuthMsg
+	}
+	return ptxt[cmrs : cmrs+n], nil
+}
+
+// load opens data chunk i, if it is not opened already. data chunks
+// but the last one must be full, otherwise offsets are not valid
+func (f *encryptedFile) load(i int64) error {
+	if f.cidx == i {
+		return nil
+	}
+
+	b, err := f.open(i, false)
+	if err != nil {
+		return err
+	}
+	if i < f.chunks-1 && len(b) != FSChunk {
+		f.cidx = -1
+		return ErrAuthMsg
+	}
+
+	f.cbuf, f.cidx = b, i
+	return nil
+}
+
+// ReadAt reads len(b) bytes of plaintext from offset off, it is safe to be
+// called in parallel
+func (f *encryptedFile) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: string(f.name), Err: fs.ErrInvalid}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var n int
+	for n < len(b) {
+		if off >= f.size {
+			return n, io.EOF
+		}
+		if err := f.load(off / FSChunk); err != nil {
+			return n, err
+		}
+
+		s := copy(b[n:], f.cbuf[off%FSChunk:])
+		n += s
+		off += int64(s)
+	}
+	return n, nil
+}
+
+// Read reads plaintext from current offset
+func (f *encryptedFile) Read(b []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > f.size-f.offset {
+		b = b[:f.size-f.offset]
+	}
+
+	n, err := f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets offset of next Read, offsets are plaintext offsets
+func (f *encryptedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: string(f.name), Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Stat returns file info of underlying file with plaintext size
+func (f *encryptedFile) Stat() (fs.FileInfo, error) {
+	return encryptedInfo{FileInfo: f.info, size: f.size}, nil
+}
+
+func (f *encryptedFile) Close() error { return f.file.Close() }
+
+func (i encryptedInfo) Size() int64 { return i.size }
+
+// ReadDir returns entries of directory, their Info reports plaintext sizes
+func (d *encryptedDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	list, err := d.ReadDirFile.ReadDir(n)
+	for i, v := range list {
+		list[i] = encryptedEntry{DirEntry: v, efs: d.efs, name: path.Join(d.name, v.Name())}
+	}
+	return list, err
+}
+
+// Info returns file info of entry, size of regular files is their plaintext size
+func (e encryptedEntry) Info() (fs.FileInfo, error) {
+	if !e.Type().IsRegular() {
+		return e.DirEntry.Info()
+	}
+
+	f, err := e.efs.Open(e.name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// seekReaderAt implements io.ReaderAt of a file which only implements io.Seeker
+type seekReaderAt struct{ io.ReadSeeker }
+
+func (s *seekReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	if _, err := s.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(s, b)
+}
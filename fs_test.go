@@ -0,0 +1,155 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestEncryptedFS(t *testing.T) {
+	big := bytes.Repeat(ptx, rabaead.FSChunk/len(ptx)+100)
+	src := fstest.MapFS{
+		"index.html":        {Data: []byte("<p>{{.}}</p>")},
+		"static/big.bin":    {Data: big},
+		"static/empty.txt":  {Data: []byte{}},
+		"static/chunk.bin":  {Data: big[:rabaead.FSChunk]},
+		"static/nested/a.b": {Data: ptx},
+	}
+
+	dir := t.TempDir()
+	if err := rabaead.EncryptFS(dir, src, key); err != nil {
+		t.Fatal(err)
+	}
+
+	efs, err := rabaead.NewEncryptedFS(os.DirFS(dir), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(efs, "index.html", "static/big.bin", "static/empty.txt",
+		"static/chunk.bin", "static/nested/a.b"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, file := range src {
+		bf, err := fs.ReadFile(efs, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bf, file.Data) {
+			t.Fatalf("%s: decrypted data is not same as plaintext", name)
+		}
+	}
+
+	tmpl, err := template.ParseFS(efs, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	tmpl.Execute(out, "text")
+	if out.String() != "<p>text</p>" {
+		t.Fatal("wrong template output")
+	}
+
+	srv := httptest.NewServer(http.FileServer(http.FS(efs)))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/static/big.bin", nil)
+	req.Header.Set("Range", "bytes=16380-16390")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	bf, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(bf, big[16380:16391]) {
+		t.Fatal("wrong range response")
+	}
+}
+
+func TestEncryptedFSReadAt(t *testing.T) {
+	data := make([]byte, 4*rabaead.FSChunk+100)
+	for i := range data {
+		data[i] = byte(i / 7)
+	}
+
+	dir := t.TempDir()
+	if err := rabaead.EncryptFS(dir, fstest.MapFS{"data": {Data: data}}, key); err != nil {
+		t.Fatal(err)
+	}
+	efs, err := rabaead.NewEncryptedFS(os.DirFS(dir), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := efs.Open("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rat := f.(io.ReaderAt)
+
+	// parallel reads of different chunks must not share opened chunk buffers
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			bf := make([]byte, 100)
+			for i := 0; i < 50; i++ {
+				off := int64((g+i)%4*rabaead.FSChunk + i)
+				if _, err := rat.ReadAt(bf, off); err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(bf, data[off:off+100]) {
+					errs <- errors.New("parallel ReadAt returned wrong plaintext")
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedFSAuth(t *testing.T) {
+	dir := t.TempDir()
+	src := fstest.MapFS{"a": {Data: ptx}, "b": {Data: ptx}}
+	if err := rabaead.EncryptFS(dir, src, key); err != nil {
+		t.Fatal(err)
+	}
+	efs, _ := rabaead.NewEncryptedFS(os.DirFS(dir), key)
+
+	// files can not be swapped
+	a, _ := os.ReadFile(filepath.Join(dir, "a"))
+	os.WriteFile(filepath.Join(dir, "b"), a, 0644)
+	if _, err := efs.Open("b"); !errors.Is(err, rabaead.ErrAuthMsg) {
+		t.Fatal("err auth must returned")
+	}
+
+	// truncated files are rejected
+	os.WriteFile(filepath.Join(dir, "a"), a[:len(a)-1], 0644)
+	if _, err := efs.Open("a"); !errors.Is(err, rabaead.ErrFSFile) {
+		t.Fatal("err fs file must returned")
+	}
+
+	a[10] ^= 0x01
+	os.WriteFile(filepath.Join(dir, "a"), a, 0644)
+	if _, err := efs.Open("a"); !errors.Is(err, rabaead.ErrAuthMsg) {
+		t.Fatal("err auth must returned")
+	}
+}
@@ -5,6 +5,8 @@ go 1.18
 require (
 	github.com/sina-ghaderi/poly1305 v0.0.0-20220724002748-c5926b03988b
 	github.com/sina-ghaderi/rabbitio v0.0.0-20220730151941-9ce26f4f872e
+	golang.org/x/crypto v0.0.0-20220525230936-793ad666bf5e
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/sys v0.0.0-20220722155257-8c9f86f7a55f // indirect
@@ -1,9 +1,13 @@
 package rabaead
 
 import (
+	"crypto/cipher"
+	"crypto/sha256"
 	"encoding/binary"
+	"io"
 
 	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabbitio"
 )
 
 func headtail(in []byte, n int) (head, tail []byte) {
@@ -33,3 +37,31 @@ func writeUint64(p *poly1305.MAC, n int) {
 	binary.LittleEndian.PutUint64(buf[:], uint64(n))
 	p.Write(buf[:])
 }
+
+func uint64Little(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, n)
+	return b
+}
+
+// writeFull writes b to w, short write without error is reported as io.ErrShortWrite
+func writeFull(w io.Writer, b []byte) (int, error) {
+	n, err := w.Write(b)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+// derivedAEAD derives a message key: sha256(key || nonce) and returns its subkey
+// aead, so chunks of a message can be sealed with counter nonces
+func derivedAEAD(key, nonce []byte) (cipher.AEAD, error) {
+	if len(key) != rabbitio.KeyLen {
+		return nil, rabbitio.ErrInvalidKey
+	}
+
+	h := sha256.New()
+	h.Write(key)
+	h.Write(nonce)
+	return newSubkeyAead(h.Sum(nil)[:rabbitio.KeyLen])
+}
@@ -0,0 +1,470 @@
+package rabaead
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+// http payload encryption: client sends HTTPHeader "kid=<key id>, nonce=<hex>, time=<unix>"
+// and request body sealed with chunkWriter in counter mode. requests without body have
+// no body and carry "tag=<hex>" in header instead, tag of an empty message with request
+// AD. server replies with HTTPHeader "nonce=<hex>" and sealed response body. every body
+// has its own key derived from key and its nonce. request AD: key id || method || request
+// uri || time, response AD: request nonce || status code, so response is bound to its
+// request. responses without body, to HEAD requests or with 1xx, 204 and 304 status, are
+// not sealed and have no encryption header.
+// server rejects requests whose time is more than HTTPMaxSkew away from its clock, and
+// nonces of authenticated requests are kept in memory for that long to reject replays.
+// replays to another handler or after restart within HTTPMaxSkew are not detected
+const (
+	HTTPHeader  = "Rabaead-Encryption"
+	HTTPMaxBody = 10 << 20 // default max size of request body: 10MiB
+	HTTPMaxSkew = 5 * time.Minute
+	httpChunk   = 0x0400
+	httpSkew    = int64(HTTPMaxSkew / time.Second)
+)
+
+var (
+	ErrHTTPEncryption = errors.New("rabaead: http message is not encrypted or has bad encryption header")
+	errHTTPReplay     = errors.New("rabaead: request is replayed or its time is out of range")
+)
+
+// tag nonce of requests without body, chunk nonces never have all bits set
+var httpTagNonce = []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// KeyFunc returns key of key id, or nil if key id is unknown
+type KeyFunc func(keyID string) []byte
+
+type httpHandler struct {
+	handler http.Handler
+	keys    KeyFunc
+	maxBody int64
+	replay  httpReplay
+}
+
+// httpReplay is nonce cache of authenticated requests
+type httpReplay struct {
+	mutex sync.Mutex
+	seen  map[string]int64 // request time of key id || nonce
+	prune int64            // last time expired nonces were removed
+}
+
+type httpHeader struct {
+	kid   string
+	nonce []byte
+	time  int64  // request time, unix seconds
+	tag   []byte // tag of request without body
+}
+
+type httpTransport struct {
+	base  http.RoundTripper
+	keyID string
+	key   []byte
+}
+
+type httpResponse struct {
+	http.ResponseWriter
+	key    []byte
+	rnon   []byte // request nonce
+	wnon   []byte // response nonce
+	method string // request method
+	plain  bool   // status is written and response has no body
+	cw     *chunkWriter
+	bw     *bufio.Writer
+}
+
+// NewHTTPHandler returns httpHandler data type, a net/http middleware which opens
+// request bodies and seals response bodies of h. request body is read and authenticated
+// before h is called, requests with bad encryption header, unknown key id or tampered
+// body are rejected with 400 and request bodies larger than max body size with 413.
+// replayed requests and requests more than HTTPMaxSkew old are rejected with 400 too
+func NewHTTPHandler(h http.Handler, keys KeyFunc) *httpHandler {
+	return &httpHandler{handler: h, keys: keys, maxBody: HTTPMaxBody}
+}
+
+// NewHTTPTransport returns httpTransport data type, a http.RoundTripper which seals
+// request bodies and opens response bodies, if base is nil http.DefaultTransport is used.
+// responses with body but without encryption header are returned as ErrHTTPEncryption
+// error, read of a tampered response body returns ErrAuthMsg and truncated body
+// io.ErrUnexpectedEOF
+func NewHTTPTransport(base http.RoundTripper, keyID string, key []byte) (*httpTransport, error) {
+	if len(key) != rabbitio.KeyLen {
+		return nil, rabbitio.ErrInvalidKey
+	}
+	if strings.ContainsAny(keyID, ", =") {
+		return nil, errors.New("rabaead: key id must not contain comma, space or equal sign")
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &httpTransport{base: base, keyID: keyID, key: make([]byte, rabbitio.KeyLen)}
+	copy(t.key, key)
+	return t, nil
+}
+
+// SetMaxBody sets max size of opened request body
+func (h *httpHandler) SetMaxBody(n int64) { h.maxBody = n }
+
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hdr, err := parseHTTPHeader(r.Header.Get(HTTPHeader), true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key := h.keys(hdr.kid)
+	if len(key) != rabbitio.KeyLen {
+		http.Error(w, "rabaead: unknown key id", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Unix()
+	if skew := now - hdr.time; skew > httpSkew || skew < -httpSkew {
+		http.Error(w, errHTTPReplay.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := h.openBody(r, hdr, key)
+	if err != nil {
+		code := http.StatusBadRequest
+		if err == errHTTPBody {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	if !h.replay.add(hdr, now) {
+		http.Error(w, errHTTPReplay.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wnon := make([]byte, rabbitio.IVXLen)
+	if _, err := io.ReadFull(rand.Reader, wnon); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	r.Header.Del(HTTPHeader)
+
+	rw := &httpResponse{ResponseWriter: w, key: key, rnon: hdr.nonce, wnon: wnon, method: r.Method}
+	h.handler.ServeHTTP(rw, r)
+	rw.close()
+}
+
+var errHTTPBody = errors.New("rabaead: request body is too large")
+
+// openBody reads and opens the whole request body, request without body must have
+// a valid header tag and no body at all
+func (h *httpHandler) openBody(r *http.Request, hdr httpHeader, key []byte) ([]byte, error) {
+	a, err := derivedAEAD(key, hdr.nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	ad := httpRequestAD(hdr.kid, r.Method, r.URL.RequestURI(), hdr.time)
+	if hdr.tag != nil {
+		if r.ContentLength != 0 {
+			return nil, ErrHTTPEncryption
+		}
+		return a.Open(nil, httpTagNonce, hdr.tag, ad)
+	}
+
+	cr, err := NewChunkReader(r.Body, httpChunk, a, nil, func() []byte { return ad })
+	if err != nil {
+		return nil, err
+	}
+	cr.SetCounter(true)
+
+	body, err := io.ReadAll(io.LimitReader(cr, h.maxBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > h.maxBody {
+		return nil, errHTTPBody
+	}
+	return body, nil
+}
+
+// RoundTrip seals request body and opens response body of req, requests without
+// body are authenticated by a tag in encryption header
+func (t *httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	nonce := make([]byte, rabbitio.IVXLen)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	a, err := derivedAEAD(t.key, nonce)
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	ad := httpRequestAD(t.keyID, req.Method, req.URL.RequestURI(), now)
+	head := fmt.Sprintf("kid=%s, nonce=%x, time=%d", t.keyID, nonce, now)
+
+	out := req.Clone(req.Context())
+	out.GetBody = nil
+
+	var pr *io.PipeReader
+	if req.Body == nil || req.Body == http.NoBody {
+		head += fmt.Sprintf(", tag=%x", a.Seal(nil, httpTagNonce, nil, ad))
+	} else {
+		var pw *io.PipeWriter
+		pr, pw = io.Pipe()
+		go sealHTTPBody(pw, req.Body, a, ad)
+
+		out.Body = pr
+		out.ContentLength = -1
+		out.Header.Del("Content-Length")
+	}
+	out.Header.Set(HTTPHeader, head)
+
+	resp, err := t.base.RoundTrip(out)
+	if err != nil {
+		if pr != nil {
+			pr.Close()
+		}
+		return nil, err
+	}
+
+	if httpNoBody(req.Method, resp.StatusCode) {
+		return resp, nil
+	}
+	if err := t.openResponse(resp, nonce); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// sealHTTPBody seals body into pw in counter mode chunks and closes both
+func sealHTTPBody(pw *io.PipeWriter, body io.ReadCloser, a cipher.AEAD, ad []byte) {
+	defer body.Close()
+	cw, _ := NewChunkWriter(pw, httpChunk, a, nil, func() []byte { return ad })
+	cw.SetCounter(true)
+
+	// chunk writer collects small reads into full chunks
+	_, err := io.Copy(cw, body)
+	if err == nil {
+		err = cw.Close() // final chunk, closes pw
+	}
+	pw.CloseWithError(err)
+}
+
+// openResponse replaces body of resp with opened body
+func (t *httpTransport) openResponse(resp *http.Response, rnon []byte) error {
+	hdr, err := parseHTTPHeader(resp.Header.Get(HTTPHeader), false)
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, resp.Status)
+	}
+
+	a, err := derivedAEAD(t.key, hdr.nonce)
+	if err != nil {
+		return err
+	}
+
+	ad := httpResponseAD(rnon, resp.StatusCode)
+	cr, err := NewChunkReader(resp.Body, httpChunk, a, nil, func() []byte { return ad })
+	if err != nil {
+		return err
+	}
+	cr.SetCounter(true)
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{cr, resp.Body}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Del(HTTPHeader)
+	return nil
+}
+
+// WriteHeader writes status code and encryption header, Content-Length header
+// is removed since sealed body is longer than plaintext
+func (w *httpResponse) WriteHeader(code int) {
+	if w.cw != nil || w.plain {
+		return
+	}
+	if code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if httpNoBody(w.method, code) {
+		w.plain = true
+		w.ResponseWriter.Header().Del("Content-Length")
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	a, err := derivedAEAD(w.key, w.wnon)
+	if err != nil {
+		panic(err) // key len is checked by handler
+	}
+
+	ad := httpResponseAD(w.rnon, code)
+	w.cw, _ = NewChunkWriter(struct{ io.Writer }{w.ResponseWriter}, httpChunk, a, nil, func() []byte { return ad })
+	w.cw.SetCounter(true)
+	w.bw = bufio.NewWriterSize(w.cw, httpChunk)
+
+	h := w.ResponseWriter.Header()
+	h.Del("Content-Length")
+	h.Set(HTTPHeader, fmt.Sprintf("nonce=%x", w.wnon))
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write seals response body, full chunks are written as they fill up. responses
+// without body are passed to underlying writer, which rejects or discards the body
+func (w *httpResponse) Write(b []byte) (int, error) {
+	if w.cw == nil {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.plain {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.bw.Write(b)
+}
+
+// Flush seals and sends buffered response body
+func (w *httpResponse) Flush() {
+	if w.cw == nil {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.bw != nil && w.bw.Flush() != nil {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close seals buffered response body and writes final chunk
+func (w *httpResponse) close() {
+	if w.cw == nil {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.plain {
+		return
+	}
+	if err := w.bw.Flush(); err != nil {
+		return
+	}
+	w.cw.Close()
+}
+
+// parseHTTPHeader parses request header "kid=<key id>, nonce=<hex>, time=<unix>" with
+// optional ", tag=<hex>", or response header "nonce=<hex>"
+func parseHTTPHeader(v string, request bool) (httpHeader, error) {
+	var h httpHeader
+	var hexNonce, unix, hexTag string
+	var hasKid, hasTime, hasTag bool
+	for _, field := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return h, ErrHTTPEncryption
+		}
+		switch k {
+		case "kid":
+			h.kid, hasKid = val, true
+		case "nonce":
+			hexNonce = val
+		case "time":
+			unix, hasTime = val, true
+		case "tag":
+			hexTag, hasTag = val, true
+		default:
+			return h, ErrHTTPEncryption
+		}
+	}
+
+	var err error
+	h.nonce, err = hex.DecodeString(hexNonce)
+	if err != nil || len(h.nonce) != rabbitio.IVXLen || request != hasKid || request != hasTime || !request && hasTag {
+		return h, ErrHTTPEncryption
+	}
+	if request {
+		if h.time, err = strconv.ParseInt(unix, 10, 64); err != nil {
+			return h, ErrHTTPEncryption
+		}
+	}
+	if hasTag {
+		if h.tag, err = hex.DecodeString(hexTag); err != nil || len(h.tag) != poly1305.TagSize {
+			return h, ErrHTTPEncryption
+		}
+	}
+	return h, nil
+}
+
+// add records nonce of an authenticated request at now, it returns false if nonce
+// is already recorded. nonces of requests older than HTTPMaxSkew are removed, since
+// such requests are rejected by their time
+func (c *httpReplay) add(h httpHeader, now int64) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.seen == nil {
+		c.seen = make(map[string]int64)
+	}
+	if now-c.prune > httpSkew {
+		for k, t := range c.seen {
+			if now-t > httpSkew {
+				delete(c.seen, k)
+			}
+		}
+		c.prune = now
+	}
+
+	id := h.kid + "\x00" + string(h.nonce)
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = h.time
+	return true
+}
+
+// httpNoBody reports whether response to method with status code has no body
+func httpNoBody(method string, code int) bool {
+	return method == http.MethodHead || code < 200 ||
+		code == http.StatusNoContent || code == http.StatusNotModified
+}
+
+func httpRequestAD(kid, method, uri string, unix int64) []byte {
+	ad := make([]byte, len(kid)+len(method)+len(uri)+10)
+	n := copy(ad, kid) + 1
+	n += copy(ad[n:], method) + 1
+	n += copy(ad[n:], uri)
+	binary.LittleEndian.PutUint64(ad[n:], uint64(unix))
+	return ad
+}
+
+func httpResponseAD(rnon []byte, code int) []byte {
+	ad := make([]byte, len(rnon)+2)
+	copy(ad, rnon)
+	binary.LittleEndian.PutUint16(ad[len(rnon):], uint16(code))
+	return ad
+}
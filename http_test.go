@@ -0,0 +1,253 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+type tamperTransport struct{ base http.RoundTripper }
+
+func (t tamperTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	bf, _ := io.ReadAll(req.Body)
+	bf[10] ^= 0x01
+	req.Body = io.NopCloser(bytes.NewReader(bf))
+	req.ContentLength = int64(len(bf))
+	return t.base.RoundTrip(req)
+}
+
+func newHTTPServer(t *testing.T) *httptest.Server {
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bf, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		switch r.URL.Path {
+		case "/empty":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "/cached":
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(r.Method + " " + r.URL.Path + " "))
+		w.Write(bf)
+	})
+
+	keys := func(id string) []byte {
+		if id == "k1" {
+			return key
+		}
+		return nil
+	}
+
+	h := rabaead.NewHTTPHandler(echo, keys)
+	h.SetMaxBody(4096)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPRoundTrip(t *testing.T) {
+	srv := newHTTPServer(t)
+	tr, err := rabaead.NewHTTPTransport(nil, "k1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: tr}
+
+	for _, body := range [][]byte{nil, ptx, bytes.Repeat(ptx, 40)} {
+		resp, err := client.Post(srv.URL+"/echo", "application/octet-stream", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bf, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusCreated || !bytes.Equal(bf, append([]byte("POST /echo "), body...)) {
+			t.Fatal("decrypted response is not same as plaintext")
+		}
+	}
+
+	// plain requests and unknown key ids are rejected
+	resp, err := http.Post(srv.URL, "text/plain", bytes.NewReader(ptx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatal("plain request must be rejected")
+	}
+
+	other, _ := rabaead.NewHTTPTransport(nil, "k2", key)
+	if _, err := (&http.Client{Transport: other}).Get(srv.URL); !errors.Is(err, rabaead.ErrHTTPEncryption) {
+		t.Fatal("err http encryption must returned")
+	}
+}
+
+func TestHTTPNoBody(t *testing.T) {
+	srv := newHTTPServer(t)
+	tr, _ := rabaead.NewHTTPTransport(nil, "k1", key)
+	client := &http.Client{Transport: tr}
+
+	// HEAD responses and 204, 304 statuses have no body, nothing is sealed
+	for _, v := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodHead, "/echo", http.StatusCreated},
+		{http.MethodGet, "/empty", http.StatusNoContent},
+		{http.MethodGet, "/cached", http.StatusNotModified},
+	} {
+		req, _ := http.NewRequest(v.method, srv.URL+v.path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", v.method, v.path, err)
+		}
+		bf, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || len(bf) != 0 || resp.StatusCode != v.code {
+			t.Fatalf("%s %s: response must have status %d and no body", v.method, v.path, v.code)
+		}
+		if resp.Header.Get(rabaead.HTTPHeader) != "" {
+			t.Fatalf("%s %s: response without body must not have encryption header", v.method, v.path)
+		}
+	}
+}
+
+// recordTransport records sealed requests before they are sent
+type recordTransport struct {
+	base http.RoundTripper
+	reqs []*http.Request
+	body [][]byte
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var bf []byte
+	if req.Body != nil {
+		bf, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(bf))
+	}
+	t.reqs = append(t.reqs, req)
+	t.body = append(t.body, bf)
+	return t.base.RoundTrip(req)
+}
+
+// resend sends recorded request i again, body is replaced with body if it is not nil
+func (t *recordTransport) resend(i int, body []byte) (int, error) {
+	req := t.reqs[i].Clone(t.reqs[i].Context())
+	if body == nil {
+		body = t.body[i]
+	}
+	req.Body, req.ContentLength = nil, 0
+	if body != nil {
+		req.Body, req.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+	}
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestHTTPReplay(t *testing.T) {
+	srv := newHTTPServer(t)
+	rec := &recordTransport{base: http.DefaultTransport}
+	tr, _ := rabaead.NewHTTPTransport(rec, "k1", key)
+	client := &http.Client{Transport: tr}
+
+	for _, body := range [][]byte{nil, ptx} {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/echo", nil)
+		if body != nil {
+			req, _ = http.NewRequest(http.MethodPut, srv.URL+"/echo", bytes.NewReader(body))
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bf, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusCreated || !bytes.Equal(bf, append([]byte("PUT /echo "), body...)) {
+			t.Fatal("decrypted response is not same as plaintext", err)
+		}
+	}
+
+	// request without body is sent without body
+	if rec.body[0] != nil || !strings.Contains(rec.reqs[0].Header.Get(rabaead.HTTPHeader), "tag=") {
+		t.Fatal("request without body must be authenticated by header tag")
+	}
+
+	for i := range rec.reqs {
+		if code, err := rec.resend(i, nil); err != nil || code != http.StatusBadRequest {
+			t.Fatalf("replayed request %d must be rejected with 400, got %d %v", i, code, err)
+		}
+	}
+
+	// body smuggled into a recorded request without body, which is never sent
+	rec = &recordTransport{base: failTransport{}}
+	tr, _ = rabaead.NewHTTPTransport(rec, "k1", key)
+	(&http.Client{Transport: tr}).Get(srv.URL + "/echo")
+	if code, err := rec.resend(0, ptx); err != nil || code != http.StatusBadRequest {
+		t.Fatalf("request without body must not carry a body, got %d %v", code, err)
+	}
+	if code, err := rec.resend(0, nil); err != nil || code != http.StatusCreated {
+		t.Fatalf("request without body must be accepted, got %d %v", code, err)
+	}
+}
+
+type failTransport struct{}
+
+func (failTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("not sent")
+}
+
+func TestHTTPTamper(t *testing.T) {
+	srv := newHTTPServer(t)
+
+	// tampered request body is rejected before handler runs, rejection is not encrypted
+	tr, _ := rabaead.NewHTTPTransport(tamperTransport{http.DefaultTransport}, "k1", key)
+	_, err := (&http.Client{Transport: tr}).Post(srv.URL, "", bytes.NewReader(ptx))
+	if !errors.Is(err, rabaead.ErrHTTPEncryption) || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("tampered body must be rejected with 400, got %v", err)
+	}
+
+	// request body larger than max body
+	tr, _ = rabaead.NewHTTPTransport(nil, "k1", key)
+	_, err = (&http.Client{Transport: tr}).Post(srv.URL, "", bytes.NewReader(make([]byte, 4097)))
+	if !errors.Is(err, rabaead.ErrHTTPEncryption) || !strings.Contains(err.Error(), "413") {
+		t.Fatalf("large body must be rejected with 413, got %v", err)
+	}
+
+	// tampered response body
+	h := srv.Config.Handler
+	rsp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		bf := rec.Body.Bytes()
+		bf[20] ^= 0x01
+		w.Header().Set(rabaead.HTTPHeader, rec.Header().Get(rabaead.HTTPHeader))
+		w.WriteHeader(rec.Code)
+		w.Write(bf)
+	}))
+	defer rsp.Close()
+
+	resp, err := (&http.Client{Transport: tr}).Post(rsp.URL, "", bytes.NewReader(ptx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+}
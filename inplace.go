@@ -0,0 +1,27 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// SealInPlace seals first plaintextLen bytes of buf in place, buf must have
+// room for the tag: len(buf) >= plaintextLen + a.Overhead(). returned slice is
+// buf[:plaintextLen+a.Overhead()], with rabbit aead SealInPlace never allocates.
+// panic occurs if nonce len is not equal to IVXLen (8byte) or zero
+func SealInPlace(a cipher.AEAD, buf, nonce, ad []byte, plaintextLen int) ([]byte, error) {
+	if plaintextLen < 0 || len(buf) < plaintextLen+a.Overhead() {
+		return nil, io.ErrShortBuffer
+	}
+	return a.Seal(buf[:0], nonce, buf[:plaintextLen], ad), nil
+}
+
+// OpenInPlace opens ciphertext and tag in buf in place, returned slice is
+// buf[:len(buf)-a.Overhead()], with rabbit aead OpenInPlace never allocates.
+// if data is not verified, ErrAuthMsg is returned and buf is left untouched
+func OpenInPlace(a cipher.AEAD, buf, nonce, ad []byte) ([]byte, error) {
+	if len(buf) < a.Overhead() {
+		return nil, ErrAuthMsg
+	}
+	return a.Open(buf[:0], nonce, buf, ad)
+}
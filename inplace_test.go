@@ -0,0 +1,85 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// TestInPlace seal and open in a fixed buffer with reserved tag space
+func TestInPlace(t *testing.T) {
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64)
+	copy(buf, ptx)
+
+	sealed, err := rabaead.SealInPlace(aead, buf, iv, nil, len(ptx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("aead encrypted: %x\n", sealed)
+
+	if &sealed[0] != &buf[0] || len(sealed) != len(ptx)+aead.Overhead() {
+		t.Fatal("data is not sealed in place")
+	}
+
+	if !bytes.Equal(sealed, aead.Seal(nil, iv, ptx, nil)) {
+		t.Fatal("in-place sealed data is not same as Seal")
+	}
+
+	opened, err := rabaead.OpenInPlace(aead, sealed, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("aead decrypted: %x\n", opened)
+
+	if &opened[0] != &buf[0] || !bytes.Equal(opened, ptx) {
+		t.Fatal("data is not opened in place")
+	}
+
+	if _, err := rabaead.SealInPlace(aead, buf[:len(ptx)+aead.Overhead()-1], iv, nil, len(ptx)); err != io.ErrShortBuffer {
+		t.Fatal("err short buffer must returned")
+	}
+
+	sealed, _ = rabaead.SealInPlace(aead, buf, iv, nil, len(ptx))
+	sealed[0] ^= 0x01
+	keep := append([]byte{}, sealed...)
+	if _, err := rabaead.OpenInPlace(aead, sealed, iv, nil); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+	if !bytes.Equal(sealed, keep) {
+		t.Fatal("buffer must be untouched on auth failure")
+	}
+}
+
+func TestInPlaceAllocs(t *testing.T) {
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ring of fixed buffers, like a packet processing loop
+	ring := make([][]byte, 4)
+	for i := range ring {
+		ring[i] = make([]byte, 1500)
+	}
+
+	var i int
+	allocs := testing.AllocsPerRun(100, func() {
+		buf := ring[i%len(ring)]
+		i++
+		sealed, _ := rabaead.SealInPlace(aead, buf, iv, nil, 1000)
+		if _, err := rabaead.OpenInPlace(aead, sealed, iv, nil); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if allocs != 0 {
+		t.Fatalf("in-place seal and open allocate %v times", allocs)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/sina-ghaderi/rabbitio"
 )
 
+const streamBlock = 0x8000 // streamReader read block size: 32KiB
+
 type streamReader struct {
 	ie        *ioaead
 	cip       cipher.Stream
@@ -16,8 +18,11 @@ type streamReader struct {
 	nwr       int
 	read      io.Reader
 	buff      []byte
-	temp      []byte
-	tagc      []byte
+	blck      []byte // read block + 16 byte tag holdback
+	have      int    // unprocessed bytes in blck
+	plin      []byte // reused plaintext block, buff is a view into it
+	final     error  // EOF, ErrAuthMsg or ErrUnexpectedEOF after underlying EOF
+	cp        checkpoint
 }
 
 type ioaead struct {
@@ -34,6 +39,7 @@ type streamWriter struct {
 	plainWriter io.Writer
 	nwr         int
 	firstWrite  bool
+	cp          checkpoint
 }
 
 var errunderio = errors.New("underlying io reader returns wrong read value, which is not supposed to happen")
@@ -57,10 +63,12 @@ func makeioaead(key, iv []byte, adfunc AdditionalFunc) *ioaead {
 	return str
 }
 
-func (s *ioaead) execAdFunc() {
+// execAdFunc writes additional data to poly and returns it
+func (s *ioaead) execAdFunc() []byte {
 	additionalData := s.additionalData()
 	s.adlen = len(additionalData)
 	writePadding(s.poly, additionalData)
+	return additionalData
 }
 
 func newCipherReader(r io.Reader, key, nonce []byte, f AdditionalFunc) (*streamReader, error) {
@@ -76,8 +84,8 @@ func newCipherReader(r io.Reader, key, nonce []byte, f AdditionalFunc) (*streamR
 		ie:   makeioaead(key, nonce, f),
 		read: r,
 		buff: []byte{},
-		tagc: make([]byte, 16),
-		temp: make([]byte, 16),
+		blck: make([]byte, streamBlock+poly1305.TagSize),
+		plin: make([]byte, streamBlock),
 	}
 
 	v.cip, _ = rabbitio.NewCipher(v.ie.key, v.ie.nonce)
@@ -115,123 +123,133 @@ func newChipherWriter(w io.Writer, key, nonce []byte, f AdditionalFunc) (*stream
 
 	v.writer, _ = rabbitio.NewWriterCipher(
 		v.ie.key, v.ie.nonce,
-		io.MultiWriter(w, v.ie.poly),
+		io.MultiWriter(w, v.ie.poly, &v.cp),
 	)
 
 	return v, nil
 }
 
-func (r *streamReader) readTo(b []byte) (int, error) {
-	var n int
-	if len(r.buff) > 0 {
-		return r.copyBuff(b), nil
-	}
-
-	sr, err := r.readBuff()
-	if err != nil {
-		if err == io.EOF {
-			n = r.copyUntil(b, sr)
-			return n, r.verify()
-		}
-		return n, err
-	}
-	return r.copyUntil(b, sr), err
-}
-
 // Read reads and open ciphertext.
 // read data is unreliable until underlying reader returns EOF
 // after that Read return EOF or ErrAuthMsg if integrity of data has been compromised.
 // in such a case, you need to unread data. a simple demonstration would be to delete
 // or truncate the file if ErrAuthMsg is returned
 func (r *streamReader) Read(b []byte) (int, error) {
-	if len(b) <= 16 {
-		return r.readTo(b)
+	if !r.firstRead {
+		r.cp.begin(r.ie.execAdFunc())
+		r.firstRead = true
 	}
-	n := 0
-	for {
-		if n+16 > len(b) {
-			sr, err := r.readTo(b[n:])
-			n += sr
-			if err != nil {
-				return n, err
-			}
-			break
-		}
 
-		sr, err := r.readTo(b[n : n+16])
-		n += sr
-		if err != nil {
-			return n, err
+	for len(r.buff) == 0 {
+		if r.final != nil {
+			return 0, r.final
 		}
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, r.buff)
+	r.buff = r.buff[n:]
+	if len(r.buff) == 0 && r.final != nil {
+		return n, r.final
 	}
 	return n, nil
 }
 
-func (r *streamReader) verify() error {
-	r.ie.ioPaddingTo(r.nwr)
-	if r.ie.poly.Verify(r.tagc) {
-		return io.EOF
+// fill reads a block from underlying reader and opens everything
+// but the last 16 bytes, which may be the poly1305 tag
+func (r *streamReader) fill() error {
+	if r.cp.size > 0 {
+		return r.fillCheckpoint()
 	}
-	return ErrAuthMsg
-}
 
-func (r *streamReader) copyUntil(b []byte, sr int) int {
-	n := copy(b, r.buff[:sr])
-	r.buff = r.buff[n:]
-	r.nwr += n
-	return n
+	n, err := r.read.Read(r.blck[r.have:])
+	if n < 0 || n > len(r.blck)-r.have {
+		return errunderio
+	}
+	r.have += n
+
+	if err == io.EOF {
+		if r.have < poly1305.TagSize {
+			r.final = io.ErrUnexpectedEOF
+			return nil
+		}
+		r.process(r.have - poly1305.TagSize)
+		r.final = r.verify(r.blck[:poly1305.TagSize])
+		return nil
+	}
+
+	if r.have > poly1305.TagSize {
+		r.process(r.have - poly1305.TagSize)
+	}
+	return err
 }
 
-func (r *streamReader) copyBuff(b []byte) int {
-	n := copy(b, r.buff)
-	r.buff = r.buff[n:]
+// process authenticates and decrypts first n bytes of read block into plaintext
+// block, then moves the rest of read block to its beginning
+func (r *streamReader) process(n int) {
+	r.ie.poly.Write(r.blck[:n])
+	r.cip.XORKeyStream(r.plin[:n], r.blck[:n])
+	r.buff = r.plin[:n]
 	r.nwr += n
-	return n
+
+	r.have = copy(r.blck, r.blck[n:r.have])
 }
 
-func (r *streamReader) readBuff() (int, error) {
+// WriteTo writes opened data to w until underlying reader returns EOF, read blocks
+// are written to w directly. like Read, written data is unreliable until WriteTo
+// returns, nil error means data is authenticated, otherwise ErrAuthMsg is returned
+func (r *streamReader) WriteTo(w io.Writer) (int64, error) {
 	if !r.firstRead {
-		r.ie.execAdFunc()
-		_, err := io.ReadFull(r.read, r.temp)
-		if err != nil {
-			return 0, err
-		}
+		r.cp.begin(r.ie.execAdFunc())
 		r.firstRead = true
 	}
 
-	var buff = make([]byte, 16)
-	n, err := r.read.Read(buff)
-	if err != nil {
-		return 0, err
-	}
-	if n > len(buff) {
-		return 0, errunderio
-	}
+	var n int64
+	for {
+		if len(r.buff) > 0 {
+			s, err := writeFull(w, r.buff)
+			r.buff = r.buff[s:]
+			n += int64(s)
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
 
-	copy(r.tagc, append(r.temp[n:], buff[:n]...))
-	r.buff = append(r.buff, r.temp[:n]...)
-	r.buffAndXor()
+		if r.final == io.EOF {
+			return n, nil
+		}
+		if r.final != nil {
+			return n, r.final
+		}
 
-	if n < 16 {
-		return n, err
+		if err := r.fill(); err != nil {
+			return n, err
+		}
 	}
-
-	copy(r.temp, buff)
-	return n, err
 }
 
-func (r *streamReader) buffAndXor() {
-	r.ie.poly.Write(r.buff)
-	r.cip.XORKeyStream(r.buff, r.buff)
+func (r *streamReader) verify(tag []byte) error {
+	r.ie.ioPaddingTo(r.nwr)
+	if r.ie.poly.Verify(tag) {
+		return io.EOF
+	}
+	return ErrAuthMsg
 }
 
 // Write writes plaintext data, in order to calculate and write tag
 // at the end of the write, running Close() is necessary
 func (w *streamWriter) Write(b []byte) (int, error) {
 	if !w.firstWrite {
-		w.ie.execAdFunc()
+		w.cp.begin(w.ie.execAdFunc())
 		w.firstWrite = true
 	}
+	if w.cp.size > 0 {
+		return w.writeCheckpoint(b)
+	}
+
 	n, err := w.writer.Write(b)
 	if err != nil {
 		return n, err
@@ -241,6 +259,29 @@ func (w *streamWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// ReadFrom reads plaintext from src until EOF and writes it in 32KiB blocks,
+// running Close() is still necessary to calculate and write tag
+func (w *streamWriter) ReadFrom(src io.Reader) (int64, error) {
+	buff := make([]byte, streamBlock)
+	var n int64
+	for {
+		s, err := src.Read(buff)
+		if s > 0 {
+			if _, err := w.Write(buff[:s]); err != nil {
+				return n, err
+			}
+			n += int64(s)
+		}
+
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
 func (p *ioaead) ioPaddingTo(nb int) {
 	if rem := nb % 16; rem != 0 {
 		var buf [16]byte
@@ -0,0 +1,84 @@
+package rabaead
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var jsonKeys keyringStore // keyring of Encrypted values
+
+var ErrJSONPath = errors.New("rabaead: encrypted json field has no Path")
+
+// Encrypted is a json field whose value is sealed with a random nonce, it implements
+// json.Marshaler and json.Unmarshaler. json of Value is sealed with current key of
+// keyring set by SetJSONKeyring and encoded as {"path": Path, "sealed": base64}. Path
+// is field path, like "user.email", bound as additional data, it must be set before
+// Marshal, empty Path is rejected with ErrJSONPath. Unmarshal opens the value with the
+// encoded path, so fresh slice elements, map values and nil pointers can be decoded,
+// and sets Path to it. if Path is already set, encoded path must be the same, so a
+// value can not be moved to another field. values with the same Path, like elements
+// of a slice, can still be swapped with each other
+type Encrypted[T any] struct {
+	Value T
+	Path  string
+}
+
+type jsonEnvelope struct {
+	Path   string `json:"path"`
+	Sealed []byte `json:"sealed"`
+}
+
+// NewEncrypted returns Encrypted with value v at field path
+func NewEncrypted[T any](path string, v T) Encrypted[T] {
+	return Encrypted[T]{Value: v, Path: path}
+}
+
+// SetJSONKeyring sets keyring of encrypted json values, Current key must exist
+func SetJSONKeyring(k Keyring) error { return jsonKeys.set(k) }
+
+// MarshalJSON seals json of Value and returns it with Path as a json object
+func (e Encrypted[T]) MarshalJSON() ([]byte, error) {
+	if e.Path == "" {
+		return nil, ErrJSONPath
+	}
+
+	b, err := json.Marshal(e.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := jsonKeys.get().seal(b, []byte(e.Path))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonEnvelope{Path: e.Path, Sealed: sealed})
+}
+
+// UnmarshalJSON opens a json object written by MarshalJSON into Value, json null is
+// a no-op. ErrAuthMsg is returned if Path is set and encoded path is not the same
+func (e *Encrypted[T]) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+
+	var env jsonEnvelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return ErrKeyringValue
+	}
+	if env.Path == "" {
+		return ErrJSONPath
+	}
+	if e.Path != "" && e.Path != env.Path {
+		return ErrAuthMsg
+	}
+
+	plain, err := jsonKeys.get().open(env.Sealed, []byte(env.Path))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(plain, &e.Value); err != nil {
+		return err
+	}
+	e.Path = env.Path
+	return nil
+}
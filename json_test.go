@@ -0,0 +1,146 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+var (
+	_ json.Marshaler   = rabaead.Encrypted[string]{}
+	_ json.Unmarshaler = &rabaead.Encrypted[string]{}
+)
+
+type jsonCard struct {
+	Number string `json:"number"`
+	Expiry int    `json:"expiry"`
+}
+
+type jsonUser struct {
+	Name  string                             `json:"name"`
+	Email rabaead.Encrypted[string]          `json:"email"`
+	Card  rabaead.Encrypted[jsonCard]        `json:"card"`
+	Tags  *rabaead.Encrypted[map[string]int] `json:"tags,omitempty"`
+}
+
+func newJSONUser() *jsonUser {
+	return &jsonUser{
+		Email: rabaead.Encrypted[string]{Path: "user.email"},
+		Card:  rabaead.Encrypted[jsonCard]{Path: "user.card"},
+	}
+}
+
+func TestEncryptedJSON(t *testing.T) {
+	if err := rabaead.SetJSONKeyring(rabaead.Keyring{Current: "k1", Keys: func(string) []byte { return key }}); err != nil {
+		t.Fatal(err)
+	}
+
+	u := newJSONUser()
+	u.Name = "sina"
+	u.Email.Value = "user@example.com"
+	u.Card.Value = jsonCard{Number: "4111111111111111", Expiry: 2612}
+
+	b, err := json.Marshal(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("aead encrypted: %s\n", b)
+	if bytes.Contains(b, []byte("example.com")) || bytes.Contains(b, []byte("4111")) {
+		t.Fatal("encrypted fields must not be in plaintext")
+	}
+
+	v := newJSONUser()
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != u.Name || v.Email.Value != u.Email.Value || v.Card.Value != u.Card.Value || v.Tags != nil {
+		t.Fatalf("decrypted user mismatch: %+v", v)
+	}
+
+	// swap sealed email and card fields
+	var raw map[string]json.RawMessage
+	json.Unmarshal(b, &raw)
+	raw["email"], raw["card"] = raw["card"], raw["email"]
+	swapped, _ := json.Marshal(raw)
+	if err := json.Unmarshal(swapped, newJSONUser()); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for moved field", err)
+	}
+
+	raw["card"] = raw["email"]
+	raw["email"] = json.RawMessage(`"` + strings.Repeat("A", 8) + `"`)
+	bad, _ := json.Marshal(raw)
+	if err := json.Unmarshal(bad, newJSONUser()); err != rabaead.ErrKeyringValue {
+		t.Fatal("err keyring value must returned for malformed value", err)
+	}
+
+	// sealed card relabeled with email path is bound to card path
+	var env map[string]json.RawMessage
+	json.Unmarshal(raw["card"], &env)
+	env["path"] = json.RawMessage(`"user.email"`)
+	raw["email"], _ = json.Marshal(env)
+	relabeled, _ := json.Marshal(raw)
+	if err := json.Unmarshal(relabeled, &struct {
+		Email rabaead.Encrypted[string] `json:"email"`
+	}{}); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for relabeled field", err)
+	}
+
+	// value without Path can not be bound to its field
+	if _, err := json.Marshal(rabaead.NewEncrypted("", "value")); !errors.Is(err, rabaead.ErrJSONPath) {
+		t.Fatal("err json path must returned for marshal", err)
+	}
+
+	// value without Path is opened with the encoded path
+	var e rabaead.Encrypted[string]
+	if err := json.Unmarshal(b, &struct {
+		Email *rabaead.Encrypted[string] `json:"email"`
+	}{&e}); err != nil {
+		t.Fatal(err)
+	}
+	if e.Value != u.Email.Value || e.Path != "user.email" {
+		t.Fatalf("decrypted email mismatch: %+v", e)
+	}
+}
+
+func TestEncryptedJSONFresh(t *testing.T) {
+	if err := rabaead.SetJSONKeyring(rabaead.Keyring{Current: "k1", Keys: func(string) []byte { return key }}); err != nil {
+		t.Fatal(err)
+	}
+
+	users := []jsonUser{*newJSONUser(), *newJSONUser()}
+	users[0].Email.Value, users[1].Email.Value = "a@example.com", "b@example.com"
+	tags := rabaead.NewEncrypted("user.tags", map[string]int{"admin": 1})
+	users[1].Tags = &tags
+	cards := map[string]rabaead.Encrypted[jsonCard]{
+		"main": rabaead.NewEncrypted("cards.main", jsonCard{Number: "4111111111111111", Expiry: 2612}),
+	}
+
+	b, err := json.Marshal(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v []jsonUser // fresh elements, Path is not set
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != 2 || v[0].Email != users[0].Email || v[1].Email != users[1].Email ||
+		v[0].Tags != nil || v[1].Tags == nil || v[1].Tags.Value["admin"] != 1 || v[1].Tags.Path != "user.tags" {
+		t.Fatalf("decrypted users mismatch: %+v", v)
+	}
+
+	b, err = json.Marshal(cards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]rabaead.Encrypted[jsonCard]
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["main"] != cards["main"] {
+		t.Fatalf("decrypted cards mismatch: %+v", m)
+	}
+}
@@ -0,0 +1,100 @@
+package rabaead
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+// keyring sealed value: version (1byte) || key id len (1byte) || key id || nonce (8byte)
+// || sealed value. value key is derived from key of key id and nonce, AD of value is
+// key id || 0x00 || AD, so a value can not be moved to another column, row or field
+const keyringVersion = 0x01
+
+var (
+	ErrKeyring      = errors.New("rabaead: keyring is not set or key id is unknown")
+	ErrKeyringValue = errors.New("rabaead: malformed encrypted value")
+)
+
+// Keyring is keyring of encrypted sql and json values. Keys returns key of a key id
+// and new values are sealed with Current key id, so keys can be rotated while old
+// values are still opened with their own key id
+type Keyring struct {
+	Current string
+	Keys    KeyFunc
+}
+
+type keyringStore struct {
+	mutex sync.RWMutex
+	ring  Keyring
+}
+
+// set sets keyring, Current key must exist
+func (s *keyringStore) set(k Keyring) error {
+	if k.Keys == nil || len(k.Current) > 0xff || len(k.Keys(k.Current)) != rabbitio.KeyLen {
+		return ErrKeyring
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ring = k
+	return nil
+}
+
+func (s *keyringStore) get() Keyring {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.ring
+}
+
+// seal seals plaintext with a random nonce and current key
+func (k Keyring) seal(plaintext, ad []byte) ([]byte, error) {
+	if k.Keys == nil {
+		return nil, ErrKeyring
+	}
+
+	nonce := make([]byte, rabbitio.IVXLen)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	a, err := derivedAEAD(k.Keys(k.Current), nonce)
+	if err != nil {
+		return nil, ErrKeyring
+	}
+
+	kid := k.Current
+	out := make([]byte, 0, 2+len(kid)+len(nonce)+len(plaintext)+a.Overhead())
+	out = append(out, keyringVersion, byte(len(kid)))
+	out = append(out, kid...)
+	out = append(out, nonce...)
+	return a.Seal(out, nonce, plaintext, keyringAD(kid, ad)), nil
+}
+
+// open opens a sealed value into a new slice, b is not modified
+func (k Keyring) open(b, ad []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != keyringVersion || len(b) < 2+int(b[1])+rabbitio.IVXLen {
+		return nil, ErrKeyringValue
+	}
+	kid := string(b[2 : 2+b[1]])
+	nonce := b[2+len(kid) : 2+len(kid)+rabbitio.IVXLen]
+	sealed := b[2+len(kid)+rabbitio.IVXLen:]
+
+	if k.Keys == nil {
+		return nil, ErrKeyring
+	}
+	a, err := derivedAEAD(k.Keys(kid), nonce)
+	if err != nil {
+		return nil, ErrKeyring
+	}
+	return a.Open([]byte{}, nonce, sealed, keyringAD(kid, ad))
+}
+
+func keyringAD(kid string, ad []byte) []byte {
+	out := make([]byte, 0, len(kid)+1+len(ad))
+	out = append(append(out, kid...), 0x00)
+	return append(out, ad...)
+}
@@ -0,0 +1,287 @@
+package rabaead
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+// encrypted log: magic (8byte) || log id (8byte) || records. record: plaintext len (4byte)
+// || sealed plaintext || tag. nonce of a record is its sequence number and AD is tag of
+// previous record (log id for first record) || len, so records can not be reordered,
+// dropped or replayed from another log. log key is derived from key and log id
+const (
+	LogMaxRecord = 1 << 24 // max plaintext size of a record: 16MiB
+	logMagic     = "rablog01"
+	logHeader    = len(logMagic) + rabbitio.IVXLen
+	logLen       = 0x04
+)
+
+var ErrLogHeader = errors.New("rabaead: not an encrypted log or unsupported version")
+
+// LogFile is an encrypted log file which can be recovered, like *os.File
+type LogFile interface {
+	io.ReadWriteSeeker
+	Truncate(size int64) error
+}
+
+type logChain struct {
+	aead  cipher.AEAD
+	seq   uint64
+	prev  [poly1305.TagSize]byte
+	nonce [rabbitio.IVXLen]byte
+	ad    [poly1305.TagSize + logLen]byte
+}
+
+type logWriter struct {
+	chain  logChain
+	writer io.Writer
+	buff   []byte // reused record buffer
+	err    error  // first write error, sticky until log is reopened
+	cut    int64  // bytes truncated by OpenLogWriter
+	mutex  sync.Mutex
+}
+
+type logReader struct {
+	chain  logChain
+	reader *bufio.Reader
+	buff   []byte // reused sealed record buffer
+	offset int64  // end of last authenticated record
+}
+
+// NewLogWriter writes header of a new encrypted log to w and returns a logWriter
+// data type, each Write call is sealed and appended as a single record
+func NewLogWriter(w io.Writer, key []byte) (*logWriter, error) {
+	head := make([]byte, logHeader)
+	copy(head, logMagic)
+	if _, err := io.ReadFull(rand.Reader, head[len(logMagic):]); err != nil {
+		return nil, err
+	}
+
+	c, err := newLogChain(key, head[len(logMagic):])
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writeFull(w, head); err != nil {
+		return nil, err
+	}
+	return &logWriter{chain: c, writer: w}, nil
+}
+
+// OpenLogWriter returns logWriter which appends to existing encrypted log f, or starts
+// a new log if f is empty. all records are verified first and f is truncated after the
+// last authentic record, so a torn, zero-filled or garbage tail left by a crash does not
+// block the log. a torn or zero-filled header is truncated and a new log is started, f
+// without a valid header is rejected with ErrLogHeader. since a tampered tail is
+// truncated too, Truncated reports number of dropped bytes
+func OpenLogWriter(f LogFile, key []byte) (*logWriter, error) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return NewLogWriter(f, key)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	r, err := NewLogReader(f, key)
+	if err == ErrLogHeader {
+		return restartLog(f, key, size)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for err == nil {
+		_, err = r.Next()
+	}
+	if err == io.ErrUnexpectedEOF || err == ErrAuthMsg {
+		err = f.Truncate(r.offset)
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &logWriter{chain: r.chain, writer: f, cut: size - r.offset}, nil
+}
+
+// restartLog starts a new log on f with a torn or zero-filled header, no record can be
+// authenticated without log id. other headers are not a log, f is not modified
+func restartLog(f LogFile, key []byte, size int64) (*logWriter, error) {
+	head := make([]byte, logHeader)
+	if size < int64(logHeader) {
+		head = head[:size]
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil, err
+	}
+
+	magic := head
+	if len(magic) > len(logMagic) {
+		magic = magic[:len(logMagic)]
+	}
+	zero := bytes.Count(head, []byte{0x00}) == len(head)
+	if !zero && (len(head) == logHeader || !bytes.HasPrefix([]byte(logMagic), magic)) {
+		return nil, ErrLogHeader
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	w, err := NewLogWriter(f, key)
+	if err != nil {
+		return nil, err
+	}
+	w.cut = size
+	return w, nil
+}
+
+// NewLogReader reads header of encrypted log r and returns a logReader data type
+func NewLogReader(r io.Reader, key []byte) (*logReader, error) {
+	br := bufio.NewReader(r)
+	head := make([]byte, logHeader)
+	if _, err := io.ReadFull(br, head); err != nil || string(head[:len(logMagic)]) != logMagic {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		return nil, ErrLogHeader
+	}
+
+	c, err := newLogChain(key, head[len(logMagic):])
+	if err != nil {
+		return nil, err
+	}
+	return &logReader{chain: c, reader: br, offset: int64(logHeader)}, nil
+}
+
+func newLogChain(key, id []byte) (logChain, error) {
+	a, err := derivedAEAD(key, id)
+	if err != nil {
+		return logChain{}, err
+	}
+
+	c := logChain{aead: a}
+	copy(c.prev[:], id)
+	return c, nil
+}
+
+// next returns nonce and AD of next record with plaintext len n
+func (c *logChain) next(n int) ([]byte, []byte) {
+	binary.LittleEndian.PutUint64(c.nonce[:], c.seq)
+	copy(c.ad[:], c.prev[:])
+	binary.LittleEndian.PutUint32(c.ad[poly1305.TagSize:], uint32(n))
+	return c.nonce[:], c.ad[:]
+}
+
+// advance moves chain to the record after record with tag
+func (c *logChain) advance(tag []byte) {
+	copy(c.prev[:], tag)
+	c.seq++
+}
+
+// Write seals b as a single record and appends it to the log with a single write
+// to underlying writer, records larger than LogMaxRecord are rejected. a failed write
+// may leave a torn record, so its error is returned by all later writes, log must be
+// reopened with OpenLogWriter to truncate the torn record and continue
+func (w *logWriter) Write(b []byte) (int, error) {
+	if len(b) > LogMaxRecord {
+		return 0, errors.New("rabaead: log record too large")
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	nonce, ad := w.chain.next(len(b))
+	w.buff = append(w.buff[:0], ad[poly1305.TagSize:]...)
+	w.buff = w.chain.aead.Seal(w.buff, nonce, b, ad)
+	if _, err := writeFull(w.writer, w.buff); err != nil {
+		w.err = err
+		return 0, err
+	}
+
+	w.chain.advance(w.buff[len(w.buff)-poly1305.TagSize:])
+	return len(b), nil
+}
+
+// Truncated returns number of bytes truncated by OpenLogWriter after the last
+// authentic record, zero for a log without torn or broken tail
+func (w *logWriter) Truncated() int64 { return w.cut }
+
+// Seq returns sequence number of next record
+func (w *logWriter) Seq() uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.chain.seq
+}
+
+// Close runs Close method of underlying writer, if there is any
+func (w *logWriter) Close() error {
+	if c, ok := w.writer.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Next returns plaintext of next record, returned slice is valid until next call.
+// io.EOF is returned at the end of log, io.ErrUnexpectedEOF if final record is torn
+// and ErrAuthMsg if a record is tampered, reordered or dropped
+func (r *logReader) Next() ([]byte, error) {
+	var lb [logLen]byte
+	if _, err := io.ReadFull(r.reader, lb[:]); err != nil {
+		return nil, err
+	}
+
+	n := int(binary.LittleEndian.Uint32(lb[:]))
+	if n > LogMaxRecord {
+		return nil, ErrAuthMsg
+	}
+
+	if cap(r.buff) < n+poly1305.TagSize {
+		r.buff = make([]byte, n+poly1305.TagSize)
+	}
+	sealed := r.buff[:n+poly1305.TagSize]
+	if _, err := io.ReadFull(r.reader, sealed); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	nonce, ad := r.chain.next(n)
+	ptxt, err := r.chain.aead.Open(sealed[:0], nonce, sealed, ad)
+	if err != nil {
+		return nil, err
+	}
+
+	r.chain.advance(sealed[n:])
+	r.offset += int64(logLen + len(sealed))
+	return ptxt, nil
+}
+
+// Seq returns sequence number of next record
+func (r *logReader) Seq() uint64 { return r.chain.seq }
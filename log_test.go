@@ -0,0 +1,216 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func readLog(t *testing.T, b []byte) ([]string, error) {
+	r, err := rabaead.NewLogReader(bytes.NewReader(b), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var list []string
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return list, err
+		}
+		list = append(list, string(rec))
+	}
+}
+
+func TestLogWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := rabaead.NewLogWriter(buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for i := 0; i < 3; i++ {
+		n := buf.Len()
+		fmt.Fprintf(w, "record %d", i)
+		sizes = append(sizes, buf.Len()-n)
+	}
+
+	list, err := readLog(t, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || list[2] != "record 2" {
+		t.Fatal("decrypted records are not same as plaintext")
+	}
+
+	enc := buf.Bytes()
+	head := len(enc) - sizes[0] - sizes[1] - sizes[2]
+
+	tampered := append([]byte{}, enc...)
+	tampered[head+6] ^= 0x01
+	if _, err := readLog(t, tampered); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+
+	// dropped record breaks the chain
+	dropped := append(append([]byte{}, enc[:head]...), enc[head+sizes[0]:]...)
+	if _, err := readLog(t, dropped); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for dropped record")
+	}
+
+	if _, err := readLog(t, enc[:len(enc)-3]); err != io.ErrUnexpectedEOF {
+		t.Fatal("err unexpected EOF must returned for torn record")
+	}
+}
+
+// tornWriter writes half of b and fails while torn is set
+type tornWriter struct {
+	buf  bytes.Buffer
+	torn bool
+}
+
+func (w *tornWriter) Write(b []byte) (int, error) {
+	if w.torn {
+		n, _ := w.buf.Write(b[:len(b)/2])
+		return n, errors.New("disk full")
+	}
+	return w.buf.Write(b)
+}
+
+func TestLogWriterError(t *testing.T) {
+	tw := &tornWriter{}
+	w, err := rabaead.NewLogWriter(tw, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	tw.torn = true
+	_, werr := w.Write([]byte("second"))
+	if werr == nil {
+		t.Fatal("write error must returned")
+	}
+
+	// later writes must not append records after the torn one
+	tw.torn = false
+	size := tw.buf.Len()
+	if _, err := w.Write([]byte("third")); err != werr || tw.buf.Len() != size {
+		t.Fatal("first write error must be sticky")
+	}
+
+	list, err := readLog(t, tw.buf.Bytes())
+	if err != io.ErrUnexpectedEOF || len(list) != 1 || list[0] != "first" {
+		t.Fatal("only torn record must follow first record")
+	}
+}
+
+func TestLogRecover(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := rabaead.OpenLogWriter(f, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("first"))
+	w.Write([]byte("second"))
+	w.Close()
+
+	// crash in the middle of second record
+	info, _ := os.Stat(name)
+	os.Truncate(name, info.Size()-5)
+
+	f, _ = os.OpenFile(name, os.O_RDWR, 0600)
+	w, err = rabaead.OpenLogWriter(f, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Seq() != 1 {
+		t.Fatal("torn record must be truncated")
+	}
+	w.Write([]byte("third"))
+	w.Close()
+
+	b, _ := os.ReadFile(name)
+	list, err := readLog(t, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0] != "first" || list[1] != "third" {
+		t.Fatal("recovered log is not same as written records")
+	}
+
+	// garbage, zero-filled and tampered tails are truncated after last authentic record
+	third := int64(4 + len("third") + 16)
+	for _, v := range []struct {
+		tail    []byte
+		tamper  bool
+		cut     int64
+		records uint64
+	}{
+		{bytes.Repeat([]byte{0x00}, 300), false, 300, 2},
+		{bytes.Repeat([]byte{0xa5}, 40), false, 40, 2},
+		{nil, true, third, 1},
+	} {
+		bad := append(append([]byte{}, b...), v.tail...)
+		if v.tamper {
+			bad[len(bad)-1] ^= 0x01
+		}
+		os.WriteFile(name, bad, 0600)
+
+		f, _ = os.OpenFile(name, os.O_RDWR, 0600)
+		w, err := rabaead.OpenLogWriter(f, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		info, _ := os.Stat(name)
+		if w.Truncated() != v.cut || w.Seq() != v.records || info.Size() != int64(len(bad))-v.cut {
+			t.Fatalf("broken tail must be truncated, truncated %d want %d", w.Truncated(), v.cut)
+		}
+	}
+}
+
+func TestLogRecoverHeader(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	for _, v := range []struct {
+		head []byte
+		err  error
+	}{
+		{[]byte("rablo"), nil},  // torn header
+		{make([]byte, 40), nil}, // zero-filled header
+		{[]byte("not a log file at all"), rabaead.ErrLogHeader},
+	} {
+		os.WriteFile(name, v.head, 0600)
+		f, _ := os.OpenFile(name, os.O_RDWR, 0600)
+		_, err := rabaead.OpenLogWriter(f, key)
+		f.Close()
+		if err != v.err {
+			t.Fatalf("%q: got %v want %v", v.head, err, v.err)
+		}
+
+		b, _ := os.ReadFile(name)
+		if v.err != nil && !bytes.Equal(b, v.head) {
+			t.Fatal("file which is not a log must not be modified")
+		}
+		if v.err == nil {
+			if list, err := readLog(t, b); err != nil || len(list) != 0 {
+				t.Fatal("new log must be started after torn header")
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package rabaead
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// merkle mode of chunk files: leaf i is sha256(0x00 || tag of data chunk i), node is
+// sha256(0x01 || left || right) and last node of an odd level is moved up unchanged.
+// final chunk of counter mode carries root (32byte) || number of data chunks (8byte),
+// so root is authenticated like any other chunk. all levels of the tree, from leaves
+// to root, are written after the final chunk, so a single chunk can be verified with
+// log2(n) hashes: data chunks || final chunk || tree
+const merkleTrailer = sha256.Size + 8
+
+var (
+	ErrMerkle      = errors.New("rabaead: merkle tree does not match root, chunk file is incomplete or tampered")
+	errMerkleChunk = errors.New("rabaead: chunk size is too small for merkle trailer")
+)
+
+type merkleHash [sha256.Size]byte
+
+type merkleTree struct {
+	leaves []merkleHash
+}
+
+type merkleReader struct {
+	reader io.ReaderAt
+	chunk  *chunkReader // opens chunks, in counter mode
+	sealed int64        // sealed chunk size
+	chunks int64        // number of data chunks
+	root   merkleHash
+	levels []int64 // number of hashes in each level
+}
+
+// SetMerkle enables merkle mode, it enables counter mode too. tags of all chunks are
+// hashed into a merkle tree, its root is sealed in the final chunk and the tree is
+// written after it on Close, so any chunk can be verified against the root with
+// NewMerkleReader. chunk size must be at least 40 bytes, writer keeps 32 bytes of
+// each chunk in memory until Close. it must be called before first Write
+func (w *chunkWriter) SetMerkle(enable bool) {
+	w.mtree = nil
+	if enable {
+		w.SetCounter(true)
+		w.mtree = &merkleTree{}
+	}
+}
+
+// MerkleRoot returns merkle root of written chunks, it is valid after Close
+func (w *chunkWriter) MerkleRoot() []byte {
+	if w.mtree == nil || !w.final {
+		return nil
+	}
+	root := w.mtree.root()
+	return root[:]
+}
+
+// SetMerkle enables merkle mode and counter mode, see chunkWriter SetMerkle. root and
+// number of chunks in the final chunk and the tree after it are verified before EOF is
+// returned, so a nil error at EOF proves the whole file is complete. it must be called
+// before first Read
+func (r *chunkReader) SetMerkle(enable bool) {
+	r.mtree = nil
+	if enable {
+		r.SetCounter(true)
+		r.mtree = &merkleTree{}
+	}
+}
+
+// NewMerkleReader returns merkleReader data type, which reads single chunks of merkle
+// mode chunk file r with size bytes in any order. final chunk is opened first, then
+// each chunk is opened and its tag is verified against the authenticated root, by
+// reading only the hashes on its path in the tree
+func NewMerkleReader(r io.ReaderAt, size int64, chnk int, a cipher.AEAD, nonce []byte, f AdditionalFunc) (*merkleReader, error) {
+	c, err := NewChunkReader(nil, chnk, a, nonce, f)
+	if err != nil {
+		return nil, err
+	}
+	c.SetCounter(true)
+
+	m := &merkleReader{reader: r, chunk: c, sealed: int64(len(c.chnk))}
+	if err := m.findChunks(size); err != nil {
+		return nil, err
+	}
+
+	trailer, err := m.open(m.chunks)
+	if err != nil {
+		return nil, err
+	}
+	if !c.final || len(trailer) != merkleTrailer ||
+		binary.LittleEndian.Uint64(trailer[sha256.Size:]) != uint64(m.chunks) {
+		return nil, ErrMerkle
+	}
+	copy(m.root[:], trailer)
+	return m, nil
+}
+
+// Chunks returns number of data chunks, padding chunks included
+func (m *merkleReader) Chunks() int64 { return m.chunks }
+
+// Root returns authenticated merkle root
+func (m *merkleReader) Root() []byte { return m.root[:] }
+
+// ReadChunk opens chunk i and verifies it against merkle root, returned plaintext
+// is valid until next call. ErrAuthMsg is returned if chunk is tampered or moved
+// and ErrMerkle if tree does not match the root
+func (m *merkleReader) ReadChunk(i int64) ([]byte, error) {
+	if i < 0 || i >= m.chunks {
+		return nil, errors.New("rabaead: merkle chunk index out of range")
+	}
+
+	ptxt, err := m.open(i)
+	if err != nil {
+		return nil, err
+	}
+	if m.chunk.final {
+		return nil, ErrAuthMsg
+	}
+
+	hash := merkleLeaf(m.chunk.chnk[len(m.chunk.chnk)-m.chunk.aead.Overhead():])
+	var sib merkleHash
+	off, idx := (m.chunks+1)*m.sealed, i
+	for _, n := range m.levels[:len(m.levels)-1] {
+		if s := idx ^ 1; s < n {
+			if _, err := m.reader.ReadAt(sib[:], off+s*sha256.Size); err != nil {
+				return nil, ErrMerkle
+			}
+			if idx&1 == 0 {
+				hash = merkleNode(hash[:], sib[:])
+			} else {
+				hash = merkleNode(sib[:], hash[:])
+			}
+		}
+		off += n * sha256.Size
+		idx /= 2
+	}
+
+	if subtle.ConstantTimeCompare(hash[:], m.root[:]) != 1 {
+		return nil, ErrMerkle
+	}
+	return ptxt, nil
+}
+
+// open opens sealed chunk i, in counter mode
+func (m *merkleReader) open(i int64) ([]byte, error) {
+	c := m.chunk
+	c.rader = io.NewSectionReader(m.reader, i*m.sealed, m.sealed)
+	c.index, c.final, c.buff = uint64(i), false, nil
+	if _, err := c.read(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return c.buff, nil
+}
+
+// findChunks finds number of data chunks of a file with size bytes:
+// (chunks + 1) * sealed chunk size + tree size, it grows with chunks
+func (m *merkleReader) findChunks(size int64) error {
+	lo, hi := int64(0), size/m.sealed
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if merkleFileSize(mid, m.sealed) < size {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if merkleFileSize(lo, m.sealed) != size {
+		return ErrMerkle
+	}
+
+	m.chunks = lo
+	m.levels = merkleLevels(lo)
+	return nil
+}
+
+func merkleFileSize(chunks, sealed int64) int64 {
+	size := (chunks + 1) * sealed
+	for _, n := range merkleLevels(chunks) {
+		size += n * sha256.Size
+	}
+	return size
+}
+
+// merkleLevels returns number of hashes in each level of a tree with n leaves
+func merkleLevels(n int64) []int64 {
+	if n == 0 {
+		return nil
+	}
+	levels := []int64{n}
+	for n > 1 {
+		n = (n + 1) / 2
+		levels = append(levels, n)
+	}
+	return levels
+}
+
+func merkleLeaf(tag []byte) merkleHash {
+	var h merkleHash
+	s := sha256.New()
+	s.Write([]byte{0x00})
+	s.Write(tag)
+	s.Sum(h[:0])
+	return h
+}
+
+func merkleNode(left, right []byte) merkleHash {
+	var h merkleHash
+	s := sha256.New()
+	s.Write([]byte{0x01})
+	s.Write(left)
+	s.Write(right)
+	s.Sum(h[:0])
+	return h
+}
+
+func (t *merkleTree) add(tag []byte) { t.leaves = append(t.leaves, merkleLeaf(tag)) }
+
+// tree returns all levels of the tree, from leaves to root
+func (t *merkleTree) tree() [][]merkleHash {
+	if len(t.leaves) == 0 {
+		return nil
+	}
+
+	levels := [][]merkleHash{t.leaves}
+	for cur := t.leaves; len(cur) > 1; cur = levels[len(levels)-1] {
+		next := make([]merkleHash, (len(cur)+1)/2)
+		for i := range next {
+			if 2*i+1 < len(cur) {
+				next[i] = merkleNode(cur[2*i][:], cur[2*i+1][:])
+			} else {
+				next[i] = cur[2*i]
+			}
+		}
+		levels = append(levels, next)
+	}
+	return levels
+}
+
+// root returns merkle root, zero hash for a tree without leaves
+func (t *merkleTree) root() merkleHash {
+	levels := t.tree()
+	if levels == nil {
+		return merkleHash{}
+	}
+	return levels[len(levels)-1][0]
+}
+
+// trailer returns plaintext of final chunk: root || number of leaves
+func (t *merkleTree) trailer() []byte {
+	root := t.root()
+	out := make([]byte, merkleTrailer)
+	copy(out, root[:])
+	binary.LittleEndian.PutUint64(out[sha256.Size:], uint64(len(t.leaves)))
+	return out
+}
+
+// marshal returns all levels of the tree, as written after the final chunk
+func (t *merkleTree) marshal() []byte {
+	var out []byte
+	for _, level := range t.tree() {
+		for _, h := range level {
+			out = append(out, h[:]...)
+		}
+	}
+	return out
+}
+
+// verify verifies final chunk plaintext of a sequential reader, the tree after it
+// and end of r
+func (t *merkleTree) verify(r io.Reader, trailer []byte) error {
+	if !bytes.Equal(trailer, t.trailer()) {
+		return ErrMerkle
+	}
+
+	want := t.marshal()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(r, got); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if !bytes.Equal(got, want) {
+		return ErrMerkle
+	}
+
+	// nothing may follow the tree
+	var one [1]byte
+	if _, err := io.ReadFull(r, one[:]); err != io.EOF {
+		if err == nil {
+			err = ErrMerkle
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestChunkMerkle(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csize := 0x40
+	chunk := 2 + csize + aead.Overhead()
+	plain := bytes.Repeat(ptx, 27) // 7 chunks, last one partial
+
+	buf := &bytes.Buffer{}
+	w, _ := rabaead.NewChunkWriter(buf, csize, aead, iv, nil)
+	w.SetMerkle(true)
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	enc := buf.Bytes()
+	t.Logf("aead encrypted: %x\n", enc)
+	// 7 leaves: 7 + 4 + 2 + 1 hashes
+	if len(enc) != 8*chunk+14*32 {
+		t.Fatal("wrong stream len, merkle tree is missing")
+	}
+
+	read := func(b []byte) ([]byte, error) {
+		r, _ := rabaead.NewChunkReader(bytes.NewReader(b), csize, aead, iv, nil)
+		r.SetMerkle(true)
+		return io.ReadAll(r)
+	}
+	got, err := read(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("merkle stream plaintext mismatch")
+	}
+
+	m, err := rabaead.NewMerkleReader(bytes.NewReader(enc), int64(len(enc)), csize, aead, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Chunks() != 7 || !bytes.Equal(m.Root(), w.MerkleRoot()) {
+		t.Fatal("wrong merkle chunks or root")
+	}
+	for _, i := range []int64{6, 0, 3} {
+		b, err := m.ReadChunk(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, plain[i*int64(csize):i*int64(csize)+int64(len(b))]) || len(b) == 0 {
+			t.Fatalf("chunk %d plaintext mismatch", i)
+		}
+	}
+
+	// tampered sibling hash of chunk 3: level 0 hash 2
+	bad := append([]byte{}, enc...)
+	bad[8*chunk+2*32] ^= 0x01
+	m, _ = rabaead.NewMerkleReader(bytes.NewReader(bad), int64(len(bad)), csize, aead, iv, nil)
+	if _, err := m.ReadChunk(3); err != rabaead.ErrMerkle {
+		t.Fatal("err merkle must returned for tampered tree", err)
+	}
+	if _, err := m.ReadChunk(5); err != nil {
+		t.Fatal("chunks off the tampered path must be readable", err)
+	}
+	if _, err := read(bad); err != rabaead.ErrMerkle {
+		t.Fatal("err merkle must returned for tampered tree", err)
+	}
+
+	bad = append([]byte{}, enc...)
+	bad[3*chunk] ^= 0x01
+	m, _ = rabaead.NewMerkleReader(bytes.NewReader(bad), int64(len(bad)), csize, aead, iv, nil)
+	if _, err := m.ReadChunk(3); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for tampered chunk", err)
+	}
+
+	if _, err := read(enc[:len(enc)-1]); err != io.ErrUnexpectedEOF {
+		t.Fatal("err unexpected eof must returned for truncated tree", err)
+	}
+	if _, err := rabaead.NewMerkleReader(bytes.NewReader(enc), int64(len(enc)-32), csize, aead, iv, nil); err != rabaead.ErrMerkle {
+		t.Fatal("err merkle must returned for truncated file", err)
+	}
+	if _, err := read(append(enc, 0x00)); err != rabaead.ErrMerkle {
+		t.Fatal("err merkle must returned for trailing data", err)
+	}
+}
+
+func TestChunkMerkleEmpty(t *testing.T) {
+	aead, _ := rabaead.NewSubkeyAEAD(key)
+	buf := &bytes.Buffer{}
+	w, _ := rabaead.NewChunkWriter(buf, 0x40, aead, iv, nil)
+	w.SetMerkle(true)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := rabaead.NewMerkleReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), 0x40, aead, iv, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Chunks() != 0 {
+		t.Fatal("empty file must have no chunks")
+	}
+
+	r, _ := rabaead.NewChunkReader(bytes.NewReader(buf.Bytes()), 0x40, aead, iv, nil)
+	r.SetMerkle(true)
+	if b, err := io.ReadAll(r); err != nil || len(b) != 0 {
+		t.Fatal("empty file must be read without error", err)
+	}
+
+	w, _ = rabaead.NewChunkWriter(&bytes.Buffer{}, 0x20, aead, iv, nil)
+	w.SetMerkle(true)
+	if err := w.Close(); err == nil {
+		t.Fatal("error must returned for chunk size smaller than merkle trailer")
+	}
+}
@@ -0,0 +1,199 @@
+package rabaead
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+const (
+	sessionLen  = 0x10 // sender session id: random (8byte) || creation time (8byte)
+	sessionRand = 0x08
+	maxSessions = 0x400
+)
+
+type packetSession struct {
+	aead *packetAEAD
+	seen time.Time
+	born int64 // sender creation time of session, unix nanoseconds
+}
+
+type packetConn struct {
+	net.PacketConn
+	key      []byte // rabbit cipher key
+	session  []byte
+	send     *packetAEAD
+	mutex    sync.Mutex
+	sessions map[string]*packetSession
+	floor    int64 // newest creation time of evicted sessions
+	padding  PaddingFunc
+}
+
+// NewPacketConn returns a packetConn data type, which implements net.PacketConn.
+// each datagram is sealed independently with a session key and explicit counter nonce
+// carried in packet header: session id (16byte) || counter (8byte) || ciphertext || tag.
+// session id is random (8byte) || creation time of packetConn (8byte unix nanoseconds)
+// and session key is derived from key and session id, so many senders can share the
+// same key without reusing nonces. there is 16+8+16 byte overhead per datagram.
+// datagrams with session id of the receiver itself are dropped, so they can not be
+// reflected back to their sender. if there are too many sessions, the least recently
+// seen one is evicted and sessions not newer than it are rejected from then on, so
+// replay windows are never restarted. replay windows are kept in memory only, a new
+// receiver accepts datagrams of sessions which are older than itself
+func NewPacketConn(c net.PacketConn, key []byte) (*packetConn, error) {
+	if len(key) != rabbitio.KeyLen {
+		return nil, rabbitio.ErrInvalidKey
+	}
+
+	v := &packetConn{
+		PacketConn: c,
+		key:        make([]byte, rabbitio.KeyLen),
+		session:    make([]byte, sessionLen),
+		sessions:   make(map[string]*packetSession),
+	}
+
+	copy(v.key, key)
+	if _, err := io.ReadFull(rand.Reader, v.session[:sessionRand]); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(v.session[sessionRand:], uint64(time.Now().UnixNano()))
+
+	var err error
+	v.send, err = v.sessionAEAD(v.session)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Overhead returns per datagram overhead: session id + counter + tag size
+func (c *packetConn) Overhead() int { return sessionLen + c.send.Overhead() }
+
+// SetPadding sets padding policy of datagram payloads, see packetAEAD SetPadding.
+// both sides must enable it and it must be called before first ReadFrom or WriteTo
+func (c *packetConn) SetPadding(f PaddingFunc) {
+	c.padding = f
+	c.send.SetPadding(f)
+}
+
+// WriteTo seals p and writes it as a single datagram to addr, it would not report
+// overhead data in its return value. len(p)+Overhead() must fit in one datagram
+func (c *packetConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	pkt := make([]byte, sessionLen, c.Overhead()+len(p)+1)
+	copy(pkt, c.session)
+	pkt = c.send.Seal(pkt, p, nil)
+
+	if _, err := c.PacketConn.WriteTo(pkt, addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// ReadFrom reads a datagram, opens it into p and returns plaintext len and sender addr.
+// corrupted, forged and replayed datagrams are dropped silently and ReadFrom waits for
+// the next one. p must be large enough to hold the largest plaintext datagram (padded
+// len if padding is enabled), larger datagrams are truncated by underlying conn and
+// dropped since they cannot be verified
+func (c *packetConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	buff := make([]byte, len(p)+c.Overhead())
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(buff)
+		if err != nil {
+			return 0, addr, err
+		}
+
+		if n < c.Overhead() {
+			continue
+		}
+
+		pkt := buff[:n]
+		if bytes.Equal(pkt[:sessionLen], c.session) {
+			continue // reflected datagram of our own session
+		}
+
+		out, err := c.open(pkt)
+		if err != nil {
+			continue
+		}
+		return copy(p, out), addr, nil
+	}
+}
+
+// open opens datagram pkt in place, padded payload may not fit in p. first datagram
+// of an unseen session is opened and its state is stored under the lock, so
+// concurrent first datagrams share one replay window
+func (c *packetConn) open(pkt []byte) ([]byte, error) {
+	id, ptxt := pkt[:sessionLen], pkt[sessionLen+packetCmrs:sessionLen+packetCmrs]
+
+	c.mutex.Lock()
+	s, ok := c.sessions[string(id)]
+	if ok {
+		s.seen = time.Now()
+		c.mutex.Unlock()
+		return s.aead.Open(ptxt, pkt[sessionLen:], nil)
+	}
+	defer c.mutex.Unlock()
+
+	// evicted sessions and sessions older than them fail closed
+	born := int64(binary.LittleEndian.Uint64(id[sessionRand:]))
+	if born <= c.floor {
+		return nil, ErrReplay
+	}
+
+	a, err := c.sessionAEAD(id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := a.Open(ptxt, pkt[sessionLen:], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.storeSession(id, &packetSession{aead: a, seen: time.Now(), born: born})
+	return out, nil
+}
+
+// storeSession stores state of an authenticated session, if there are too many sessions,
+// the least recently seen one is evicted and floor is moved to its creation time.
+// c.mutex must be held
+func (c *packetConn) storeSession(id []byte, s *packetSession) {
+	if len(c.sessions) >= maxSessions {
+		var oldest string
+		for k, v := range c.sessions {
+			if oldest == "" || v.seen.Before(c.sessions[oldest].seen) {
+				oldest = k
+			}
+		}
+		if born := c.sessions[oldest].born; born > c.floor {
+			c.floor = born
+		}
+		delete(c.sessions, oldest)
+	}
+	c.sessions[string(id)] = s
+}
+
+// sessionAEAD derives session key: sha256(key || session id) and returns its packetAEAD
+func (c *packetConn) sessionAEAD(id []byte) (*packetAEAD, error) {
+	h := sha256.New()
+	h.Write(c.key)
+	h.Write(id)
+
+	a, err := newSubkeyAead(h.Sum(nil)[:rabbitio.KeyLen])
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := NewPacketAEAD(a)
+	if err != nil {
+		return nil, err
+	}
+	p.SetPadding(c.padding)
+	return p, nil
+}
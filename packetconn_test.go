@@ -0,0 +1,210 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// TestPacketConn send sealed datagrams over udp, forged and replayed datagrams must be dropped
+func TestPacketConn(t *testing.T) {
+	sc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	cc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	server, err := rabaead.NewPacketConn(sc, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := rabaead.NewPacketConn(cc, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// raw conn captures sealed datagrams to replay them later
+	rc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	if _, err := client.WriteTo(ptx, rc.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := make([]byte, 1500)
+	n, _, err := rc.ReadFrom(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed = sealed[:n]
+	t.Logf("aead encrypted: %x\n", sealed)
+
+	if n != len(ptx)+client.Overhead() {
+		t.Fatal("wrong datagram len")
+	}
+
+	forged := append([]byte{}, sealed...)
+	forged[len(forged)-1] ^= 0x01
+	for _, pkt := range [][]byte{forged, sealed, sealed} {
+		if _, err := rc.WriteTo(pkt, sc.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := client.WriteTo(append(ptx, 0x02), sc.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	want := [][]byte{ptx, append(ptx, 0x02)}
+	for _, w := range want {
+		pbf := make([]byte, 64)
+		n, _, err := server.ReadFrom(pbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("aead decrypted: %x\n", pbf[:n])
+		if !bytes.Equal(pbf[:n], w) {
+			t.Fatal("decrypted data is not same as plaintext")
+		}
+	}
+}
+
+// queueConn is an in-memory net.PacketConn, ReadFrom returns queued datagrams
+// and io.EOF when queue is empty, WriteTo stores written datagrams
+type queueConn struct {
+	net.PacketConn
+	mutex sync.Mutex
+	in    [][]byte
+	out   [][]byte
+}
+
+func (q *queueConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.in) == 0 {
+		return 0, nil, io.EOF
+	}
+	n := copy(b, q.in[0])
+	q.in = q.in[1:]
+	return n, nil, nil
+}
+
+func (q *queueConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.out = append(q.out, append([]byte{}, b...))
+	return len(b), nil
+}
+
+// sealPacket returns a datagram of p sealed by c
+func sealPacket(t *testing.T, c net.PacketConn, q *queueConn, p []byte) []byte {
+	if _, err := c.WriteTo(p, nil); err != nil {
+		t.Fatal(err)
+	}
+	return q.out[len(q.out)-1]
+}
+
+// readPackets returns plaintext of all datagrams accepted by c
+func readPackets(c net.PacketConn) [][]byte {
+	var list [][]byte
+	for {
+		pbf := make([]byte, 64)
+		n, _, err := c.ReadFrom(pbf)
+		if err != nil {
+			return list
+		}
+		list = append(list, pbf[:n])
+	}
+}
+
+func TestPacketConnReflect(t *testing.T) {
+	q := &queueConn{}
+	c, err := rabaead.NewPacketConn(q, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// datagram sent back to its sender is not peer traffic
+	q.in = append(q.in, sealPacket(t, c, q, ptx))
+	if list := readPackets(c); len(list) != 0 {
+		t.Fatal("reflected datagram must be dropped")
+	}
+}
+
+func TestPacketConnEvict(t *testing.T) {
+	rq := &queueConn{}
+	recv, _ := rabaead.NewPacketConn(rq, key)
+
+	// one more sender than session table holds, first one is evicted
+	var first, second []byte
+	for i := 0; i < 0x401; i++ {
+		sq := &queueConn{}
+		sender, err := rabaead.NewPacketConn(sq, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rq.in = append(rq.in, sealPacket(t, sender, sq, ptx))
+		if i == 0 {
+			second = sealPacket(t, sender, sq, ptx)
+			first = rq.in[0]
+		}
+	}
+	if list := readPackets(recv); len(list) != 0x401 {
+		t.Fatal("datagrams of all senders must be accepted")
+	}
+
+	// evicted session fails closed, newer sessions are still accepted
+	sq := &queueConn{}
+	sender, _ := rabaead.NewPacketConn(sq, key)
+	rq.in = append(rq.in, first, second, sealPacket(t, sender, sq, append(ptx, 0x02)))
+	list := readPackets(recv)
+	if len(list) != 1 || !bytes.Equal(list[0], append(ptx, 0x02)) {
+		t.Fatal("datagrams of evicted session must be dropped")
+	}
+}
+
+func TestPacketConnFirstReplay(t *testing.T) {
+	rq, sq := &queueConn{}, &queueConn{}
+	recv, _ := rabaead.NewPacketConn(rq, key)
+	sender, _ := rabaead.NewPacketConn(sq, key)
+
+	// replays of the first datagram of a new session, read in parallel
+	pkt := sealPacket(t, sender, sq, ptx)
+	for i := 0; i < 8; i++ {
+		rq.in = append(rq.in, pkt)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var accepted int
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := len(readPackets(recv))
+			mutex.Lock()
+			accepted += n
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Fatalf("first datagram is accepted %d times", accepted)
+	}
+}
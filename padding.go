@@ -0,0 +1,98 @@
+package rabaead
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+const padMarker = 0x80 // iso/iec 7816-4 padding marker, followed by zero bytes
+
+var ErrPadding = errors.New("rabaead: bad payload padding")
+
+// padding func, return value is padded len for n bytes of payload.
+// return values smaller than n are treated as n, nil PaddingFunc means no padding
+type PaddingFunc func(n int) int
+
+// PadBucket returns a PaddingFunc which pads to the smallest bucket size not less
+// than payload len, payloads larger than the largest bucket are padded to
+// a multiple of the largest bucket
+func PadBucket(sizes ...int) PaddingFunc {
+	s := make([]int, 0, len(sizes))
+	for _, v := range sizes {
+		if v > 0 {
+			s = append(s, v)
+		}
+	}
+	sort.Ints(s)
+
+	return func(n int) int {
+		if len(s) == 0 {
+			return n
+		}
+		for _, v := range s {
+			if v >= n {
+				return v
+			}
+		}
+		max := s[len(s)-1]
+		return (n + max - 1) / max * max
+	}
+}
+
+// PadPowerOfTwo pads to the next power of two, it can be used as a PaddingFunc
+func PadPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// PadRandom returns a PaddingFunc which pads with uniform random 0 to max bytes,
+// random values are read from crypto/rand.Reader. if reading fails, payload is
+// padded with max bytes, which hides its len at least as well
+func PadRandom(max int) PaddingFunc {
+	return func(n int) int {
+		if max <= 0 {
+			return n
+		}
+		r, err := rand.Int(rand.Reader, big.NewInt(int64(max)+1))
+		if err != nil {
+			return n + max
+		}
+		return n + int(r.Int64())
+	}
+}
+
+// padPayload appends padded payload to dst: payload || 0x80 || 0x00...
+// f gets payload len including 1 byte padding marker
+func padPayload(dst, payload []byte, f PaddingFunc) []byte {
+	n := len(payload) + 1
+	if m := f(n); m > n {
+		n = m
+	}
+
+	ret, out := headtail(dst, n)
+	copy(out, payload)
+	out[len(payload)] = padMarker
+	for i := len(payload) + 1; i < len(out); i++ {
+		out[i] = 0x00
+	}
+	return ret
+}
+
+// unpadPayload strips padding of a payload padded by padPayload
+func unpadPayload(b []byte) ([]byte, error) {
+	for i := len(b) - 1; i >= 0; i-- {
+		switch b[i] {
+		case 0x00:
+			continue
+		case padMarker:
+			return b[:i], nil
+		}
+		break
+	}
+	return nil, ErrPadding
+}
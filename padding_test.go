@@ -0,0 +1,110 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestPaddingFunc(t *testing.T) {
+	bucket := rabaead.PadBucket(64, 16, 256)
+	for n, want := range map[int]int{1: 16, 16: 16, 17: 64, 200: 256, 300: 512} {
+		if got := bucket(n); got != want {
+			t.Fatalf("bucket padding of %d: got %d want %d", n, got, want)
+		}
+	}
+
+	for n, want := range map[int]int{1: 1, 3: 4, 16: 16, 17: 32} {
+		if got := rabaead.PadPowerOfTwo(n); got != want {
+			t.Fatalf("power of two padding of %d: got %d want %d", n, got, want)
+		}
+	}
+
+	random := rabaead.PadRandom(8)
+	for i := 0; i < 64; i++ {
+		if got := random(10); got < 10 || got > 18 {
+			t.Fatalf("random padding out of range: %d", got)
+		}
+	}
+
+	// failing crypto/rand must not panic, payload is padded with max bytes
+	reader := rand.Reader
+	rand.Reader = iotest.ErrReader(errors.New("no entropy"))
+	defer func() { rand.Reader = reader }()
+	if got := random(10); got != 18 {
+		t.Fatalf("random padding without crypto/rand: got %d want 18", got)
+	}
+}
+
+// TestChunkPadding chunk count must be padded, reader must skip empty chunks
+func TestChunkPadding(t *testing.T) {
+	buf := &bytes.Buffer{}
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, _ := rabaead.NewChunkWriter(buf, 0x08, aead, iv, nil)
+	w.SetPadding(rabaead.PadBucket(64))
+	if _, err := w.Write(ptx[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("aead encrypted: %x\n", buf.Bytes())
+	if buf.Len() != 8*(2+8+aead.Overhead()) {
+		t.Fatal("wrong padded stream len")
+	}
+
+	r, _ := rabaead.NewChunkReader(buf, 0x08, aead, iv, nil)
+	bf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("aead decrypted: %x\n", bf)
+	if !bytes.Equal(bf, ptx[:3]) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+}
+
+func TestPacketPadding(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, _ := rabaead.NewPacketAEAD(aead)
+	r, _ := rabaead.NewPacketAEAD(aead)
+	w.SetPadding(rabaead.PadPowerOfTwo)
+	r.SetPadding(rabaead.PadPowerOfTwo)
+
+	for _, p := range [][]byte{{}, ptx[:1], ptx} {
+		pkt := w.Seal([]byte{}, p, nil)
+		if len(pkt)-w.Overhead() != rabaead.PadPowerOfTwo(len(p)+1) {
+			t.Fatal("wrong padded packet len")
+		}
+
+		bf, err := r.Open([]byte{0x00}, pkt, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bf[1:], p) {
+			t.Fatal("decrypted data is not same as plaintext")
+		}
+	}
+
+	// padded payloads are rejected if sender does not pad
+	r.SetPadding(nil)
+	pkt := r.Seal([]byte{}, ptx, nil)
+	if _, err := w.Open([]byte{}, pkt, nil); err != rabaead.ErrPadding {
+		t.Fatal("err padding must returned")
+	}
+}
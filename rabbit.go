@@ -0,0 +1,160 @@
+package rabaead
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+const rabbitBlock = 0x10 // rabbit keystream block size: 16byte
+
+var rabbitAro = [8]uint32{
+	0x4D34D34D, 0xD34D34D3,
+	0x34D34D34, 0x4D34D34D,
+	0xD34D34D3, 0x34D34D34,
+	0x4D34D34D, 0xD34D34D3,
+}
+
+// rabbitState is rabbit cipher state, it mirrors rabbitio bit for bit for compatibility.
+// it is not RFC 4503: counter update of rabbitio subtracts instead of adds (see nextState),
+// so output does not match RFC test vectors. key schedule is done once by the aead and
+// the state is copied for every nonce
+type rabbitState struct {
+	xbit  [8]uint32
+	cbit  [8]uint32
+	carry uint32
+}
+
+// rabbitStream is a keystream generator of a rabbitState, implements cipher.Stream
+type rabbitStream struct {
+	state rabbitState
+	ks    [rabbitBlock]byte
+	koff  int // consumed bytes of ks
+}
+
+func newRabbitState(key []byte) rabbitState {
+	var k [4]uint32
+	for i := range k {
+		k[i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+
+	var r rabbitState
+	r.xbit[0] = k[0]
+	r.xbit[1] = k[3]<<16 | k[2]>>16
+	r.xbit[2] = k[1]
+	r.xbit[3] = k[0]<<16 | k[3]>>16
+	r.xbit[4] = k[2]
+	r.xbit[5] = k[1]<<16 | k[0]>>16
+	r.xbit[6] = k[3]
+	r.xbit[7] = k[2]<<16 | k[1]>>16
+	r.cbit[0] = bits.RotateLeft32(k[2], 16)
+	r.cbit[1] = k[0]&0xffff0000 | k[1]&0xffff
+	r.cbit[2] = bits.RotateLeft32(k[3], 16)
+	r.cbit[3] = k[1]&0xffff0000 | k[2]&0xffff
+	r.cbit[4] = bits.RotateLeft32(k[0], 16)
+	r.cbit[5] = k[2]&0xffff0000 | k[3]&0xffff
+	r.cbit[6] = bits.RotateLeft32(k[1], 16)
+	r.cbit[7] = k[3]&0xffff0000 | k[0]&0xffff
+	for i := 0; i < 4; i++ {
+		r.nextState()
+	}
+	for i := range r.cbit {
+		r.cbit[i] ^= r.xbit[(i+4)%8]
+	}
+	return r
+}
+
+// stream returns keystream generator of nonce, state itself is not modified.
+// panic occurs if nonce len is not equal to IVXLen (8byte) or zero
+func (r *rabbitState) stream(nonce []byte, s *rabbitStream) {
+	if len(nonce) != 0 && len(nonce) != rabbitio.IVXLen {
+		panic(rabbitio.ErrInvalidIVX)
+	}
+
+	s.state = *r
+	s.koff = rabbitBlock
+	if len(nonce) == 0 {
+		return
+	}
+
+	var v [4]uint32
+	for i := range v {
+		v[i] = uint32(binary.LittleEndian.Uint16(nonce[i*2:]))
+	}
+
+	c := &s.state.cbit
+	c[0] ^= v[1]<<16 | v[0]
+	c[1] ^= v[3]<<16 | v[1]
+	c[2] ^= v[3]<<16 | v[2]
+	c[3] ^= v[2]<<16 | v[0]
+	c[4] ^= v[1]<<16 | v[0]
+	c[5] ^= v[3]<<16 | v[1]
+	c[6] ^= v[3]<<16 | v[2]
+	c[7] ^= v[2]<<16 | v[0]
+	for i := 0; i < 4; i++ {
+		s.state.nextState()
+	}
+}
+
+// nextState runs counter and next-state functions, counter uses Sub32 like rabbitio
+func (r *rabbitState) nextState() {
+	var g [8]uint32
+	for i := range r.cbit {
+		r.carry, r.cbit[i] = bits.Sub32(rabbitAro[i], r.cbit[i], r.carry)
+	}
+	for i := range g {
+		uv := uint64(r.xbit[i] + r.cbit[i])
+		uv *= uv
+		g[i] = uint32(uv>>32) ^ uint32(uv)
+	}
+	r.xbit[0] = g[0] + bits.RotateLeft32(g[7], 16) + bits.RotateLeft32(g[6], 16)
+	r.xbit[1] = g[1] + bits.RotateLeft32(g[0], 8) + g[7]
+	r.xbit[2] = g[2] + bits.RotateLeft32(g[1], 16) + bits.RotateLeft32(g[0], 16)
+	r.xbit[3] = g[3] + bits.RotateLeft32(g[2], 8) + g[1]
+	r.xbit[4] = g[4] + bits.RotateLeft32(g[3], 16) + bits.RotateLeft32(g[2], 16)
+	r.xbit[5] = g[5] + bits.RotateLeft32(g[4], 8) + g[3]
+	r.xbit[6] = g[6] + bits.RotateLeft32(g[5], 16) + bits.RotateLeft32(g[4], 16)
+	r.xbit[7] = g[7] + bits.RotateLeft32(g[6], 8) + g[5]
+}
+
+// extract writes next 16 bytes of keystream into ks
+func (r *rabbitState) extract(ks *[rabbitBlock]byte) {
+	r.nextState()
+	x := &r.xbit
+	binary.LittleEndian.PutUint32(ks[0:], x[0]^(x[5]>>16|x[3]<<16))
+	binary.LittleEndian.PutUint32(ks[4:], x[2]^(x[7]>>16|x[5]<<16))
+	binary.LittleEndian.PutUint32(ks[8:], x[4]^(x[1]>>16|x[7]<<16))
+	binary.LittleEndian.PutUint32(ks[12:], x[6]^(x[3]>>16|x[1]<<16))
+}
+
+// XORKeyStream xor every byte of src with keystream and write result on dst,
+// whole blocks are processed 4 bytes at a time
+func (s *rabbitStream) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("rabaead: output smaller than input")
+	}
+
+	for len(src) > 0 && s.koff < rabbitBlock {
+		dst[0] = src[0] ^ s.ks[s.koff]
+		dst, src = dst[1:], src[1:]
+		s.koff++
+	}
+
+	for len(src) >= rabbitBlock {
+		s.state.extract(&s.ks)
+		for i := 0; i < rabbitBlock; i += 4 {
+			v := binary.LittleEndian.Uint32(src[i:]) ^ binary.LittleEndian.Uint32(s.ks[i:])
+			binary.LittleEndian.PutUint32(dst[i:], v)
+		}
+		dst, src = dst[rabbitBlock:], src[rabbitBlock:]
+	}
+
+	if len(src) > 0 {
+		s.state.extract(&s.ks)
+		for i := range src {
+			dst[i] = src[i] ^ s.ks[i]
+		}
+		s.koff = len(src)
+	}
+}
@@ -0,0 +1,163 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+const (
+	replayBlocks = 0x20 // ring bitmap blocks, each block is a uint64
+	replayBlkBit = 0x40 // bits per ring block
+	packetCmrs   = 0x08 // packet counter nonce indicator, carried in packet header
+
+	// ReplayWindowSize is how far behind the highest accepted counter a
+	// counter can be and still be accepted by ReplayWindow: 1984 packets
+	ReplayWindowSize = (replayBlocks - 1) * replayBlkBit
+)
+
+var ErrReplay = errors.New("rabaead: replayed or too old packet")
+
+// ReplayWindow is a sliding bitmap of accepted counters, like IPsec and wireguard
+// anti-replay window. zero value is an empty window, ready to use.
+// ReplayWindow is not safe for concurrent use
+type ReplayWindow struct {
+	last uint64
+	ring [replayBlocks]uint64
+}
+
+// Check reports whether counter is neither a duplicate nor too old,
+// Check does not mark counter as seen
+func (w *ReplayWindow) Check(counter uint64) bool {
+	if counter > w.last {
+		return true
+	}
+
+	if w.last-counter > ReplayWindowSize {
+		return false
+	}
+
+	blk := (counter / replayBlkBit) % replayBlocks
+	return w.ring[blk]&(1<<(counter%replayBlkBit)) == 0
+}
+
+// Accept checks counter and marks it as seen, it returns false if counter is a
+// duplicate or too old. counter should be accepted only after authentication,
+// otherwise forged packets can move the window forward
+func (w *ReplayWindow) Accept(counter uint64) bool {
+	if !w.Check(counter) {
+		return false
+	}
+
+	if counter > w.last {
+		cur := w.last / replayBlkBit
+		dif := counter/replayBlkBit - cur
+		if dif > replayBlocks {
+			dif = replayBlocks
+		}
+		for i := uint64(1); i <= dif; i++ {
+			w.ring[(cur+i)%replayBlocks] = 0
+		}
+		w.last = counter
+	}
+
+	blk := (counter / replayBlkBit) % replayBlocks
+	w.ring[blk] |= 1 << (counter % replayBlkBit)
+	return true
+}
+
+// Reset clears the window
+func (w *ReplayWindow) Reset() { *w = ReplayWindow{} }
+
+type packetAEAD struct {
+	aead    cipher.AEAD
+	counter uint64
+	window  ReplayWindow
+	mutex   sync.Mutex
+	padding PaddingFunc
+}
+
+// NewPacketAEAD returns a packetAEAD data type, a datagram wrapper around aead that
+// uses a 8-byte little endian counter as nonce and carries it in packet header.
+// received counters are checked against a ReplayWindow, duplicate or too old packets
+// are rejected with ErrReplay. since counter starts from zero on both sides, each
+// direction of a conversation must use its own key, otherwise nonce will be reused.
+// aead should be NewSubkeyAEAD, NewAEAD maps consecutive counters to the same keystream
+func NewPacketAEAD(a cipher.AEAD) (*packetAEAD, error) {
+	if a.NonceSize() != rabbitio.IVXLen {
+		return nil, rabbitio.ErrInvalidIVX
+	}
+	return &packetAEAD{aead: a}, nil
+}
+
+// Overhead returns packet header + aead tag size: 8byte + 16byte
+func (p *packetAEAD) Overhead() int { return packetCmrs + p.aead.Overhead() }
+
+// SetPadding sets padding policy of sealed payloads, padding is applied inside
+// the sealed payload with 1 byte marker, so both sides must enable it.
+// SetPadding must be called before first Seal or Open
+func (p *packetAEAD) SetPadding(f PaddingFunc) { p.padding = f }
+
+// Seal seals plaintext with next send counter and appends counter || ciphertext
+// to dst. it is safe to call Seal from multiple goroutines.
+// panic occurs if send counter is exhausted
+func (p *packetAEAD) Seal(dst, plaintext, ad []byte) []byte {
+	ctr := atomic.AddUint64(&p.counter, 1) - 1
+	if ctr == ^uint64(0) {
+		panic("rabaead: packet counter exhausted")
+	}
+
+	if p.padding != nil {
+		plaintext = padPayload(nil, plaintext, p.padding)
+	}
+
+	ret, out := headtail(dst, packetCmrs)
+	binary.LittleEndian.PutUint64(out, ctr)
+	return p.aead.Seal(ret, out, plaintext, ad)
+}
+
+// Open authenticates and opens a packet sealed by Seal, ErrAuthMsg will be returned if
+// packet is corrupted and ErrReplay if its counter was already seen or is too old.
+// if padding is enabled and payload is not padded, ErrPadding will be returned.
+// it is safe to call Open from multiple goroutines
+func (p *packetAEAD) Open(dst, packet, ad []byte) ([]byte, error) {
+	if len(packet) < p.Overhead() {
+		return nil, ErrAuthMsg
+	}
+
+	nonce := packet[:packetCmrs]
+	ctr := binary.LittleEndian.Uint64(nonce)
+
+	p.mutex.Lock()
+	fresh := p.window.Check(ctr)
+	p.mutex.Unlock()
+	if !fresh {
+		return nil, ErrReplay
+	}
+
+	ret, err := p.aead.Open(dst, nonce, packet[packetCmrs:], ad)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	fresh = p.window.Accept(ctr)
+	p.mutex.Unlock()
+	if !fresh {
+		return nil, ErrReplay
+	}
+
+	if p.padding == nil {
+		return ret, nil
+	}
+
+	out, err := unpadPayload(ret[len(dst):])
+	if err != nil {
+		return nil, err
+	}
+	return ret[:len(dst)+len(out)], nil
+}
@@ -0,0 +1,99 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestReplayWindow(t *testing.T) {
+	w := &rabaead.ReplayWindow{}
+	for _, c := range []uint64{0, 1, 2, 5, 4, 3} {
+		if !w.Accept(c) {
+			t.Fatalf("counter %d must be accepted", c)
+		}
+	}
+
+	for _, c := range []uint64{0, 3, 5} {
+		if w.Accept(c) {
+			t.Fatalf("duplicate counter %d must be rejected", c)
+		}
+	}
+
+	if !w.Accept(5 + rabaead.ReplayWindowSize) {
+		t.Fatal("counter inside the window must be accepted")
+	}
+
+	if !w.Check(6) || w.Check(4) {
+		t.Fatal("window edge is not respected")
+	}
+
+	if !w.Accept(1 << 20) {
+		t.Fatal("counter far ahead must be accepted")
+	}
+
+	if w.Check(1<<20 - rabaead.ReplayWindowSize - 1) {
+		t.Fatal("too old counter must be rejected")
+	}
+
+	if !w.Accept(1<<20 - 1) {
+		t.Fatal("counter after a jump must be accepted")
+	}
+}
+
+// TestPacketAEAD seal and open packets, replayed packets must be rejected
+func TestPacketAEAD(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := rabaead.NewPacketAEAD(aead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := rabaead.NewPacketAEAD(aead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := w.Seal([]byte{}, ptx, nil)
+	second := w.Seal([]byte{}, ptx, nil)
+	t.Logf("aead encrypted: %x\n", first)
+
+	if len(first) != len(ptx)+w.Overhead() {
+		t.Fatal("wrong packet len")
+	}
+
+	if bytes.Equal(first, second) {
+		t.Fatal("packets must use different nonces")
+	}
+
+	for _, pkt := range [][]byte{second, first} {
+		bf, err := r.Open([]byte{}, pkt, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bf, ptx) {
+			t.Fatal("decrypted data is not same as plaintext")
+		}
+	}
+
+	if _, err := r.Open([]byte{}, first, nil); err != rabaead.ErrReplay {
+		t.Fatal("err replay must returned")
+	}
+
+	third := w.Seal([]byte{}, ptx, nil)
+	third[len(third)-1] ^= 0x01
+	if _, err := r.Open([]byte{}, third, nil); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+
+	// forged packet must not mark its counter as seen
+	third[len(third)-1] ^= 0x01
+	if _, err := r.Open([]byte{}, third, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,84 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const checkpointLen = 0x18 // marshaled ChunkCheckpoint: index || skip || plain
+
+// ChunkCheckpoint is read position of a chunkReader: reading resumes at chunk Index,
+// Skip plaintext bytes of that chunk are already consumed and Plain is the total of
+// consumed plaintext bytes, where output can be resumed
+type ChunkCheckpoint struct {
+	Index uint64
+	Skip  int
+	Plain int64
+}
+
+var errCheckpoint = errors.New("rabaead: bad chunk checkpoint")
+
+// Checkpoint returns read position of r, it can be taken between any two reads
+func (r *chunkReader) Checkpoint() ChunkCheckpoint {
+	cp := ChunkCheckpoint{Index: r.pos, Plain: r.plain}
+	if len(r.buff) > 0 {
+		cp.Index--
+		cp.Skip = r.clen - len(r.buff)
+	}
+	return cp
+}
+
+// Offset returns ciphertext offset of chunk Index, where underlying reader must be
+// positioned to resume, for example with a http range request
+func (cp ChunkCheckpoint) Offset(chnk int, a cipher.AEAD) int64 {
+	return int64(cp.Index) * int64(cmrs+chnk+a.Overhead())
+}
+
+// ResumeChunkReader returns chunkReader which resumes reading from checkpoint cp,
+// r must be positioned at cp.Offset of the sealed stream. chunk size, aead, nonce
+// and AdFunc must be the same as the original reader, SetCounter must be called again
+// if counter mode is used. chunk at checkpoint is opened again, so it is authenticated
+// before its remaining bytes are returned
+func ResumeChunkReader(r io.Reader, chnk int, a cipher.AEAD, nonce []byte, f AdditionalFunc, cp ChunkCheckpoint) (*chunkReader, error) {
+	if cp.Skip < 0 || cp.Skip > chnk || cp.Plain < 0 {
+		return nil, errCheckpoint
+	}
+
+	s, err := NewChunkReader(r, chnk, a, nonce, f)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pos, s.index = cp.Index, cp.Index
+	s.skip, s.plain = cp.Skip, cp.Plain
+	return s, nil
+}
+
+// MarshalBinary encodes checkpoint as 24 bytes
+func (cp ChunkCheckpoint) MarshalBinary() ([]byte, error) {
+	b := make([]byte, checkpointLen)
+	binary.LittleEndian.PutUint64(b[0:], cp.Index)
+	binary.LittleEndian.PutUint64(b[8:], uint64(cp.Skip))
+	binary.LittleEndian.PutUint64(b[16:], uint64(cp.Plain))
+	return b, nil
+}
+
+// UnmarshalBinary decodes checkpoint encoded by MarshalBinary
+func (cp *ChunkCheckpoint) UnmarshalBinary(b []byte) error {
+	if len(b) != checkpointLen {
+		return errCheckpoint
+	}
+
+	skip, plain := binary.LittleEndian.Uint64(b[8:]), binary.LittleEndian.Uint64(b[16:])
+	if skip > uint64(^uint16(0)) || plain > 1<<62 {
+		return errCheckpoint
+	}
+	*cp = ChunkCheckpoint{
+		Index: binary.LittleEndian.Uint64(b[0:]),
+		Skip:  int(skip),
+		Plain: int64(plain),
+	}
+	return nil
+}
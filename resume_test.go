@@ -0,0 +1,82 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// failReader fails after n bytes, like a broken download
+type failReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *failReader) Read(b []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, io.ErrClosedPipe
+	}
+	if len(b) > f.n {
+		b = b[:f.n]
+	}
+	n, err := f.r.Read(b)
+	f.n -= n
+	return n, err
+}
+
+func TestResumeChunkReader(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := bytes.Repeat(ptx, 5)
+	buf := &bytes.Buffer{}
+	w, _ := rabaead.NewChunkWriter(buf, 0x08, aead, iv, nil)
+	w.SetCounter(true)
+	w.Write(plain)
+	w.Close()
+	enc := buf.Bytes()
+
+	for _, fail := range []int{0, 30, 52, len(enc) - 3} {
+		out := &bytes.Buffer{}
+		r, _ := rabaead.NewChunkReader(&failReader{bytes.NewReader(enc), fail}, 0x08, aead, iv, nil)
+		r.SetCounter(true)
+
+		// read in odd sizes, so checkpoint is taken inside a chunk
+		pbf := make([]byte, 3)
+		for {
+			n, err := r.Read(pbf)
+			out.Write(pbf[:n])
+			if err != nil {
+				break
+			}
+		}
+
+		cp := r.Checkpoint()
+		if cp.Plain != int64(out.Len()) {
+			t.Fatal("wrong consumed plaintext len")
+		}
+
+		b, _ := cp.MarshalBinary()
+		var rcp rabaead.ChunkCheckpoint
+		if err := rcp.UnmarshalBinary(b); err != nil || rcp != cp {
+			t.Fatal("checkpoint marshal round trip failed")
+		}
+
+		off := rcp.Offset(0x08, aead)
+		rr, err := rabaead.ResumeChunkReader(bytes.NewReader(enc[off:]), 0x08, aead, iv, nil, rcp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr.SetCounter(true)
+		if _, err := io.Copy(out, rr); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), plain) {
+			t.Fatalf("resumed data is not same as plaintext, failed at %d", fail)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+// Package secrets encrypts only values of yaml, json and env files, keys and yaml
+// comments stay readable for diffs. it is a separate package, so rabaead does not
+// depend on yaml
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sina-ghaderi/rabaead"
+	"github.com/sina-ghaderi/rabbitio"
+	"gopkg.in/yaml.v3"
+)
+
+// secrets file: a value is replaced with string: prefix || base64 of nonce (8byte) ||
+// sealed json of value, so numbers and bools keep their type. value is sealed with
+// rabaead.NewSubkeyAEAD and a random nonce, AD of value is its key path: each map key
+// or list index as len (4byte) || key, so a value can not be moved to another key.
+// removed keys are not detected. values are sealed as json, so yaml scalars which have
+// no json type, like timestamps, binary or custom tagged scalars, are decrypted back
+// as plain strings without their tag
+const prefix = "rabaead:v1:"
+
+// Format is format of a secrets file
+type Format int
+
+const (
+	YAML Format = iota
+	JSON
+	Env // KEY=VALUE lines, values are strings
+)
+
+var (
+	ErrSecrets = errors.New("secrets: malformed secrets file or unencrypted value")
+	ErrPrefix  = errors.New("secrets: plaintext value starts with encrypted value prefix")
+)
+
+// ParseFormat returns format of name: yaml, yml, json or env
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "yaml", "yml":
+		return YAML, nil
+	case "json":
+		return JSON, nil
+	case "env":
+		return Env, nil
+	}
+	return 0, fmt.Errorf("secrets: unknown secrets format %q", name)
+}
+
+// FormatOf returns format of file name by its extension, like config.yaml or .env
+func FormatOf(name string) (Format, error) {
+	return ParseFormat(strings.TrimPrefix(filepath.Ext(name), "."))
+}
+
+// Encrypt encrypts all values of secrets file data, values which are already encrypted
+// are opened to verify them and left untouched, so new plaintext values can be added
+// to an encrypted file. a value with encrypted value prefix which can not be opened,
+// like a plaintext value which starts with it, is rejected with ErrPrefix. yaml
+// comments and order of keys are kept, json output is indented
+func Encrypt(data []byte, f Format, key []byte) ([]byte, error) {
+	a, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return transform(data, f, func(path []string, v any) (any, error) {
+		if s, ok := v.(string); ok && strings.HasPrefix(s, prefix) {
+			if _, err := openSecret(a, path, v); err != nil {
+				return nil, ErrPrefix
+			}
+			return v, nil
+		}
+		return sealSecret(a, path, v)
+	})
+}
+
+// Decrypt decrypts all values of encrypted secrets file data back to a plaintext file,
+// for editing. ErrSecrets is returned if a value is not encrypted
+func Decrypt(data []byte, f Format, key []byte) ([]byte, error) {
+	a, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return transform(data, f, func(path []string, v any) (any, error) {
+		return openSecret(a, path, v)
+	})
+}
+
+// Load decrypts all values of encrypted secrets file data into a map, top level of
+// yaml and json files must be a map. ErrSecrets is returned if a value is not
+// encrypted and rabaead.ErrAuthMsg if a value is tampered or moved to another key
+func Load(data []byte, f Format, key []byte) (map[string]any, error) {
+	plain, err := Decrypt(data, f, key)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any)
+	switch f {
+	case YAML:
+		err = yaml.Unmarshal(plain, &m)
+	case JSON:
+		err = json.Unmarshal(plain, &m)
+	case Env:
+		err = eachEnvLine(plain, func(line envLine) error {
+			if line.key != "" {
+				m[line.key] = line.value
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadFile reads encrypted secrets file name, format is detected by its extension
+func LoadFile(name string, key []byte) (map[string]any, error) {
+	f, err := FormatOf(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Load(data, f, key)
+}
+
+// secretFunc returns new value of scalar v at key path
+type secretFunc func(path []string, v any) (any, error)
+
+func transform(data []byte, f Format, fn secretFunc) ([]byte, error) {
+	switch f {
+	case YAML:
+		return transformYAML(data, fn)
+	case JSON:
+		return transformJSON(data, fn)
+	case Env:
+		return transformEnv(data, fn)
+	}
+	return nil, fmt.Errorf("secrets: unknown secrets format %d", f)
+}
+
+func sealSecret(a cipher.AEAD, path []string, v any) (string, error) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, rabbitio.IVXLen)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := a.Seal(nonce, nonce, plain, secretsAD(path))
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openSecret(a cipher.AEAD, path []string, v any) (any, error) {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, prefix) {
+		return nil, ErrSecrets
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(s[len(prefix):])
+	if err != nil || len(sealed) < rabbitio.IVXLen {
+		return nil, ErrSecrets
+	}
+
+	nonce := sealed[:rabbitio.IVXLen]
+	plain, err := a.Open(nil, nonce, sealed[rabbitio.IVXLen:], secretsAD(path))
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(plain))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, ErrSecrets
+	}
+	return v, nil
+}
+
+// secretsAD returns key path with length prefixed elements, so keys which contain
+// separator bytes can not collide
+func secretsAD(path []string) []byte {
+	var ad []byte
+	var n [4]byte
+	for _, p := range path {
+		binary.LittleEndian.PutUint32(n[:], uint32(len(p)))
+		ad = append(append(ad, n[:]...), p...)
+	}
+	return ad
+}
+
+func transformYAML(data []byte, fn secretFunc) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		return data, nil // empty file
+	}
+
+	if err := walkYAML(&doc, nil, fn); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// walkYAML runs fn on scalar values of n, aliases are skipped since their anchor
+// is already walked
+func walkYAML(n *yaml.Node, path []string, fn secretFunc) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			if err := walkYAML(c, path, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if err := walkYAML(n.Content[i+1], append(path, n.Content[i].Value), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			if err := walkYAML(c, append(path, strconv.Itoa(i)), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		nv, err := fn(path, v)
+		if err != nil {
+			return err
+		}
+		return setYAML(n, nv)
+	}
+	return nil
+}
+
+// setYAML sets scalar node n to v, comments of n are kept
+func setYAML(n *yaml.Node, v any) error {
+	if num, ok := v.(json.Number); ok {
+		if i, err := num.Int64(); err == nil {
+			v = i
+		} else if f, err := num.Float64(); err == nil {
+			v = f
+		}
+	}
+
+	head, line, foot := n.HeadComment, n.LineComment, n.FootComment
+	if err := n.Encode(v); err != nil {
+		return err
+	}
+	n.HeadComment, n.LineComment, n.FootComment = head, line, foot
+	return nil
+}
+
+func transformJSON(data []byte, fn secretFunc) ([]byte, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	v, err := walkJSON(v, nil, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// walkJSON runs fn on scalar values of v and returns the new value
+func walkJSON(v any, path []string, fn secretFunc) (any, error) {
+	var err error
+	switch t := v.(type) {
+	case map[string]any:
+		for k, c := range t {
+			if t[k], err = walkJSON(c, append(path, k), fn); err != nil {
+				return nil, err
+			}
+		}
+		return t, nil
+	case []any:
+		for i, c := range t {
+			if t[i], err = walkJSON(c, append(path, strconv.Itoa(i)), fn); err != nil {
+				return nil, err
+			}
+		}
+		return t, nil
+	}
+	return fn(path, v)
+}
+
+// envLine is a line of env file, key is empty for blank and comment lines
+type envLine struct {
+	text   string
+	export bool
+	key    string
+	value  string
+}
+
+func transformEnv(data []byte, fn secretFunc) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := eachEnvLine(data, func(line envLine) error {
+		if line.key == "" {
+			buf.WriteString(line.text + "\n")
+			return nil
+		}
+
+		v, err := fn([]string{line.key}, line.value)
+		if err != nil {
+			return err
+		}
+		s, ok := v.(string)
+		if !ok {
+			return ErrSecrets
+		}
+
+		if line.export {
+			buf.WriteString("export ")
+		}
+		buf.WriteString(line.key + "=" + quoteEnv(s) + "\n")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// eachEnvLine parses env file data and runs fn on each line. values may be quoted
+// with double quotes, like go strings, or with single quotes
+func eachEnvLine(data []byte, fn func(envLine) error) error {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := envLine{text: s.Text()}
+		text := strings.TrimSpace(line.text)
+		if text != "" && !strings.HasPrefix(text, "#") {
+			if strings.HasPrefix(text, "export ") {
+				line.export = true
+				text = strings.TrimSpace(text[len("export "):])
+			}
+
+			eq := strings.IndexByte(text, '=')
+			if eq <= 0 {
+				return ErrSecrets
+			}
+			line.key = strings.TrimSpace(text[:eq])
+			value, err := unquoteEnv(strings.TrimSpace(text[eq+1:]))
+			if err != nil {
+				return err
+			}
+			line.value = value
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+func unquoteEnv(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", ErrSecrets
+		}
+		return v, nil
+	}
+	return s, nil
+}
+
+func quoteEnv(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n#'\"\\$`") {
+		return strconv.Quote(s)
+	}
+	return s
+}
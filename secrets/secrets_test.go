@@ -0,0 +1,202 @@
+package secrets_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+	"github.com/sina-ghaderi/rabaead/secrets"
+)
+
+var key = []byte{
+	0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff,
+}
+
+var secretsYAML = []byte(`# database settings
+db:
+  host: db.internal
+  port: 5432
+  password: hunter2 # rotate yearly
+tls: true
+hosts:
+  - a.internal
+  - b.internal
+`)
+
+func TestSecretsYAML(t *testing.T) {
+	enc, err := secrets.Encrypt(secretsYAML, secrets.YAML, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("aead encrypted: \n%s", enc)
+
+	for _, s := range []string{"# database settings", "# rotate yearly", "db:", "password:", "hosts:"} {
+		if !bytes.Contains(enc, []byte(s)) {
+			t.Fatalf("encrypted file must keep %q", s)
+		}
+	}
+	if bytes.Contains(enc, []byte("hunter2")) || bytes.Contains(enc, []byte("5432")) {
+		t.Fatal("values must be encrypted")
+	}
+
+	// already encrypted values are left untouched
+	again, err := secrets.Encrypt(enc, secrets.YAML, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again, enc) {
+		t.Fatal("encrypted values must not be encrypted again")
+	}
+
+	m, err := secrets.Load(enc, secrets.YAML, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"db":    map[string]any{"host": "db.internal", "port": 5432, "password": "hunter2"},
+		"tls":   true,
+		"hosts": []any{"a.internal", "b.internal"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("loaded secrets mismatch: %v", m)
+	}
+
+	dec, err := secrets.Decrypt(enc, secrets.YAML, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, secretsYAML) {
+		t.Fatalf("decrypted file mismatch: \n%s", dec)
+	}
+
+	// move sealed password to host
+	lines := strings.Split(string(enc), "\n")
+	var host, pass int
+	for i, l := range lines {
+		if strings.Contains(l, "host:") {
+			host = i
+		}
+		if strings.Contains(l, "password:") {
+			pass = i
+		}
+	}
+	lines[host] = strings.Replace(lines[pass], "password:", "host:", 1)
+	if _, err := secrets.Load([]byte(strings.Join(lines, "\n")), secrets.YAML, key); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for moved value", err)
+	}
+
+	plain := append(enc, []byte("extra: plaintext\n")...)
+	if _, err := secrets.Load(plain, secrets.YAML, key); err != secrets.ErrSecrets {
+		t.Fatal("err secrets must returned for unencrypted value", err)
+	}
+}
+
+func TestSecretsJSON(t *testing.T) {
+	src := []byte(`{"api": {"token": "t0k3n", "retries": 3, "ratio": 0.5}, "debug": false, "tags": ["x", null]}`)
+	enc, err := secrets.Encrypt(src, secrets.JSON, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enc, []byte("t0k3n")) || !bytes.Contains(enc, []byte(`"retries"`)) {
+		t.Fatal("only values must be encrypted")
+	}
+
+	m, err := secrets.Load(enc, secrets.JSON, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want map[string]any
+	json.Unmarshal(src, &want)
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("loaded secrets mismatch: %v", m)
+	}
+
+	if _, err := secrets.Load(enc, secrets.JSON, bytes.Repeat([]byte{0x01}, 16)); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for wrong key", err)
+	}
+}
+
+func TestSecretsEnv(t *testing.T) {
+	src := []byte("# app\nexport DB_URL=\"postgres://u:p@db/app?x=1 2\"\nTOKEN='abc'\n\nEMPTY=\n")
+	enc, err := secrets.Encrypt(src, secrets.Env, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enc, []byte("postgres")) || !bytes.HasPrefix(enc, []byte("# app\nexport DB_URL=rabaead:")) {
+		t.Fatalf("only values must be encrypted: \n%s", enc)
+	}
+
+	m, err := secrets.Load(enc, secrets.Env, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"DB_URL": "postgres://u:p@db/app?x=1 2", "TOKEN": "abc", "EMPTY": ""}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("loaded secrets mismatch: %v", m)
+	}
+
+	dec, err := secrets.Decrypt(enc, secrets.Env, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dec) != "# app\nexport DB_URL=\"postgres://u:p@db/app?x=1 2\"\nTOKEN=abc\n\nEMPTY=\"\"\n" {
+		t.Fatalf("decrypted file mismatch: \n%s", dec)
+	}
+}
+
+// yaml scalars without a json type are sealed as json, so they are decrypted
+// back as plain strings and their tag is lost
+func TestSecretsYAMLTypes(t *testing.T) {
+	src := []byte("created: 2024-01-02T03:04:05Z\nlabel: !custom abc\n")
+	enc, err := secrets.Encrypt(src, secrets.YAML, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := secrets.Decrypt(enc, secrets.YAML, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dec) != "created: \"2024-01-02T03:04:05Z\"\nlabel: abc\n" {
+		t.Fatalf("decrypted file mismatch: \n%s", dec)
+	}
+}
+
+func TestSecretsPrefix(t *testing.T) {
+	src := []byte("TOKEN=rabaead:v1:not-encrypted\n")
+	if _, err := secrets.Encrypt(src, secrets.Env, key); err != secrets.ErrPrefix {
+		t.Fatal("err prefix must returned for plaintext with prefix", err)
+	}
+
+	// sealed value moved to another key is not left untouched either
+	enc, err := secrets.Encrypt([]byte("A=1\nB=2\n"), secrets.Env, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(enc), "\n")
+	lines[1] = "B" + lines[0][1:]
+	if _, err := secrets.Encrypt([]byte(strings.Join(lines, "\n")), secrets.Env, key); err != secrets.ErrPrefix {
+		t.Fatal("err prefix must returned for moved value", err)
+	}
+}
+
+func TestSecretsPath(t *testing.T) {
+	enc, err := secrets.Encrypt([]byte(`{"a": {"b": "x"}, "a\u0000b": "y"}`), secrets.JSON, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// key with separator byte must not share AD with nested key
+	var m map[string]any
+	json.Unmarshal(enc, &m)
+	m["a\x00b"] = m["a"].(map[string]any)["b"]
+	moved, _ := json.Marshal(m)
+	if _, err := secrets.Load(moved, secrets.JSON, key); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for moved value", err)
+	}
+}
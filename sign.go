@@ -0,0 +1,65 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"crypto/ed25519"
+	"errors"
+
+	"github.com/sina-ghaderi/poly1305"
+)
+
+// SignedOverhead is ed25519 signature + poly1305 tag size: 64byte + 16byte
+const SignedOverhead = ed25519.SignatureSize + poly1305.TagSize
+
+const signContext = "rabaead signed message v1"
+
+var ErrSignature = errors.New("rabaead: sender signature verification failed")
+
+// SealSigned signs plaintext with sender ed25519 private key, then seals signature
+// and plaintext with aead. signature covers nonce, additional data and plaintext, so
+// put recipient identity in ad if a signed message must not be forwarded to others.
+// panic occurs if nonce len is not equal to IVXLen (8byte) or zero, or priv len is wrong
+func SealSigned(a cipher.AEAD, dst, nonce, plaintext, ad []byte, priv ed25519.PrivateKey) []byte {
+	sig := ed25519.Sign(priv, signedMessage(nonce, plaintext, ad))
+
+	inner := make([]byte, 0, ed25519.SignatureSize+len(plaintext))
+	inner = append(inner, sig...)
+	inner = append(inner, plaintext...)
+	return a.Seal(dst, nonce, inner, ad)
+}
+
+// OpenSigned opens a message sealed by SealSigned and verifies its signature with
+// sender ed25519 public key. if data is not verified, ErrAuthMsg will be returned,
+// if data is authentic but not signed by pub, ErrSignature will be returned
+func OpenSigned(a cipher.AEAD, dst, nonce, ciphertext, ad []byte, pub ed25519.PublicKey) ([]byte, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, ErrSignature
+	}
+
+	if len(ciphertext) < SignedOverhead {
+		return nil, ErrAuthMsg
+	}
+
+	inner, err := a.Open([]byte{}, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, plaintext := inner[:ed25519.SignatureSize], inner[ed25519.SignatureSize:]
+	if !ed25519.Verify(pub, signedMessage(nonce, plaintext, ad), sig) {
+		return nil, ErrSignature
+	}
+
+	return append(dst, plaintext...), nil
+}
+
+// signedMessage returns: context || len(nonce) || nonce || len(ad) || ad || plaintext
+func signedMessage(nonce, plaintext, ad []byte) []byte {
+	msg := make([]byte, 0, len(signContext)+16+len(nonce)+len(ad)+len(plaintext))
+	msg = append(msg, signContext...)
+	msg = append(msg, uint64Little(uint64(len(nonce)))...)
+	msg = append(msg, nonce...)
+	msg = append(msg, uint64Little(uint64(len(ad)))...)
+	msg = append(msg, ad...)
+	return append(msg, plaintext...)
+}
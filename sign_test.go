@@ -0,0 +1,73 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+// TestSealSigned sign-then-encrypt with ed25519 and rabbit aead
+func TestSealSigned(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ad := []byte("recipient-a")
+	bf := rabaead.SealSigned(aead, []byte{}, iv, ptx, ad, priv)
+	t.Logf("aead encrypted: %x\n", bf)
+
+	if len(bf) != len(ptx)+rabaead.SignedOverhead {
+		t.Fatal("wrong signed message len")
+	}
+
+	bf, err = rabaead.OpenSigned(aead, []byte{}, iv, bf, ad, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("aead decrypted: %x\n", bf)
+
+	if !bytes.Equal(bf, ptx) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+}
+
+func TestOpenSignedErr(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := rabaead.NewAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bf := rabaead.SealSigned(aead, []byte{}, iv, ptx, nil, priv)
+	if _, err := rabaead.OpenSigned(aead, []byte{}, iv, bf, nil, other); err != rabaead.ErrSignature {
+		t.Fatal("err signature must returned")
+	}
+
+	// any key holder can forge the aead layer, but not the signature
+	forged := aead.Seal([]byte{}, iv, append(make([]byte, ed25519.SignatureSize), ptx...), nil)
+	if _, err := rabaead.OpenSigned(aead, []byte{}, iv, forged, nil, other); err != rabaead.ErrSignature {
+		t.Fatal("err signature must returned")
+	}
+
+	bf[0] ^= 0x01
+	if _, err := rabaead.OpenSigned(aead, []byte{}, iv, bf, nil, other); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+}
@@ -0,0 +1,86 @@
+package rabaead
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+var sqlKeys keyringStore // keyring of EncryptedBytes and EncryptedString
+
+// EncryptedBytes is a []byte column sealed with a random nonce, it implements
+// sql.Scanner and driver.Valuer. nil Bytes is stored as NULL. AD is optional
+// additional data like table, column or row id, it must be set before Scan
+type EncryptedBytes struct {
+	Bytes []byte
+	AD    []byte
+}
+
+// EncryptedString is a string column sealed like EncryptedBytes, Valid is false for NULL
+type EncryptedString struct {
+	String string
+	Valid  bool
+	AD     []byte
+}
+
+// SetSQLKeyring sets keyring of encrypted sql values, Current key must exist
+func SetSQLKeyring(k Keyring) error { return sqlKeys.set(k) }
+
+// Value seals Bytes with current key of keyring
+func (e EncryptedBytes) Value() (driver.Value, error) {
+	if e.Bytes == nil {
+		return nil, nil
+	}
+	return sealSQL(e.Bytes, e.AD)
+}
+
+// Scan opens an encrypted value, src must be []byte, string or nil
+func (e *EncryptedBytes) Scan(src any) error {
+	if src == nil {
+		e.Bytes = nil
+		return nil
+	}
+
+	b, err := openSQL(src, e.AD)
+	if err != nil {
+		return err
+	}
+	e.Bytes = b
+	return nil
+}
+
+// Value seals String with current key of keyring
+func (e EncryptedString) Value() (driver.Value, error) {
+	if !e.Valid {
+		return nil, nil
+	}
+	return sealSQL([]byte(e.String), e.AD)
+}
+
+// Scan opens an encrypted value, src must be []byte, string or nil
+func (e *EncryptedString) Scan(src any) error {
+	if src == nil {
+		e.String, e.Valid = "", false
+		return nil
+	}
+
+	b, err := openSQL(src, e.AD)
+	if err != nil {
+		return err
+	}
+	e.String, e.Valid = string(b), true
+	return nil
+}
+
+func sealSQL(plaintext, ad []byte) ([]byte, error) {
+	return sqlKeys.get().seal(plaintext, ad)
+}
+
+func openSQL(src any, ad []byte) ([]byte, error) {
+	switch v := src.(type) {
+	case []byte:
+		return sqlKeys.get().open(v, ad)
+	case string:
+		return sqlKeys.get().open([]byte(v), ad)
+	}
+	return nil, fmt.Errorf("rabaead: can not scan %T into encrypted value", src)
+}
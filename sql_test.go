@@ -0,0 +1,77 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/sina-ghaderi/rabaead"
+)
+
+var (
+	_ sql.Scanner   = &rabaead.EncryptedBytes{}
+	_ driver.Valuer = rabaead.EncryptedString{}
+)
+
+func TestEncryptedSQL(t *testing.T) {
+	old := bytes.Repeat([]byte{0x01}, 16)
+	keys := func(id string) []byte {
+		switch id {
+		case "k1":
+			return old
+		case "k2":
+			return key
+		}
+		return nil
+	}
+
+	if err := rabaead.SetSQLKeyring(rabaead.Keyring{Current: "k3", Keys: keys}); err != rabaead.ErrKeyring {
+		t.Fatal("err keyring must returned for unknown current key")
+	}
+	if err := rabaead.SetSQLKeyring(rabaead.Keyring{Current: "k1", Keys: keys}); err != nil {
+		t.Fatal(err)
+	}
+
+	ad := []byte("users.email:42")
+	v, err := rabaead.EncryptedString{String: "user@example.com", Valid: true, AD: ad}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("aead encrypted: %x\n", v)
+
+	// rotated keyring still opens values of old key
+	rabaead.SetSQLKeyring(rabaead.Keyring{Current: "k2", Keys: keys})
+	s := rabaead.EncryptedString{AD: ad}
+	if err := s.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Valid || s.String != "user@example.com" {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+
+	// value moved to another row
+	moved := rabaead.EncryptedString{AD: []byte("users.email:43")}
+	if err := moved.Scan(v); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+
+	b := rabaead.EncryptedBytes{Bytes: ptx}
+	v, _ = b.Value()
+	var sb rabaead.EncryptedBytes
+	if err := sb.Scan(string(v.([]byte))); err != nil || !bytes.Equal(sb.Bytes, ptx) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+
+	// NULL values
+	if v, err := (rabaead.EncryptedBytes{}).Value(); v != nil || err != nil {
+		t.Fatal("nil bytes must be stored as NULL")
+	}
+	if err := sb.Scan(nil); err != nil || sb.Bytes != nil {
+		t.Fatal("NULL must be scanned as nil bytes")
+	}
+
+	if err := sb.Scan([]byte{0x01, 0x05, 'k'}); err != rabaead.ErrKeyringValue {
+		t.Fatal("err keyring value must returned")
+	}
+}
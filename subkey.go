@@ -0,0 +1,66 @@
+package rabaead
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+
+	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabbitio"
+)
+
+// subkeyPoly1305 is rabbit poly1305 aead which mixes nonce into a per message key
+// instead of rabbit iv setup. rabbitPoly1305 stays compatible with rabbitio, whose iv
+// setup maps many nonces, like consecutive counters, to the same keystream. first 32
+// bytes of keystream are poly1305 key only, plaintext is encrypted from byte 32
+type subkeyPoly1305 struct {
+	key []byte
+}
+
+// NewSubkeyAEAD returns a rabbit aead data-type, which seals every message with key
+// sha256(key || nonce) and zero len rabbit iv. plaintext is encrypted with keystream
+// after poly1305 key, so known plaintext never reveals it. it is not compatible with
+// NewAEAD, use it when nonces are counters or many random nonces share the same key.
+// key must be 16 byte len
+func NewSubkeyAEAD(key []byte) (cipher.AEAD, error) { return newSubkeyAead(key) }
+
+func newSubkeyAead(key []byte) (cipher.AEAD, error) {
+	if len(key) != rabbitio.KeyLen {
+		return nil, rabbitio.ErrInvalidKey
+	}
+
+	c := &subkeyPoly1305{key: make([]byte, rabbitio.KeyLen)}
+	copy(c.key, key)
+	return c, nil
+}
+
+// Overhead returns poly1305 tag size: 16byte
+func (c *subkeyPoly1305) Overhead() int { return poly1305.TagSize }
+
+// NonceSize returns nonce len: 8byte
+func (c *subkeyPoly1305) NonceSize() int { return rabbitio.IVXLen }
+
+// message returns rabbitPoly1305 of message key, panic occurs if nonce len is not 8byte
+func (c *subkeyPoly1305) message(nonce []byte) rabbitPoly1305 {
+	if len(nonce) != rabbitio.IVXLen {
+		panic(rabbitio.ErrInvalidIVX)
+	}
+
+	var sum [sha256.Size]byte
+	h := sha256.New()
+	h.Write(c.key)
+	h.Write(nonce)
+	h.Sum(sum[:0])
+	return rabbitPoly1305{state: newRabbitState(sum[:rabbitio.KeyLen]), noncesize: rabbitio.IVXLen, split: true}
+}
+
+// Seal seals a plaintext into the rabbit aead ciphertext, like rabbitPoly1305 Seal
+func (c *subkeyPoly1305) Seal(dst, nonce, plaintext, ad []byte) []byte {
+	m := c.message(nonce)
+	return m.Seal(dst, nil, plaintext, ad)
+}
+
+// Open opens a rabbit aead ciphertext, like rabbitPoly1305 Open
+func (c *subkeyPoly1305) Open(dst, nonce, ciphertext, ad []byte) ([]byte, error) {
+	m := c.message(nonce)
+	return m.Open(dst, nil, ciphertext, ad)
+}
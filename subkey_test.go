@@ -0,0 +1,84 @@
+package rabaead_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/sina-ghaderi/poly1305"
+	"github.com/sina-ghaderi/rabaead"
+)
+
+func TestSubkeyAEAD(t *testing.T) {
+	aead, err := rabaead.NewSubkeyAEAD(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := aead.Seal([]byte{}, iv, ptx, []byte("additional data"))
+	t.Logf("aead encrypted: %x\n", ctx)
+	bf, err := aead.Open(nil, iv, ctx, []byte("additional data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bf, ptx) {
+		t.Fatal("decrypted data is not same as plaintext")
+	}
+
+	if _, err := aead.Open(nil, make([]byte, 8), ctx, []byte("additional data")); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned")
+	}
+}
+
+// TestSubkeyCounter counter nonces must not share keystream
+func TestSubkeyCounter(t *testing.T) {
+	aead, _ := rabaead.NewSubkeyAEAD(key)
+	seen := map[string]bool{}
+	nonce := make([]byte, 8)
+	for i := uint64(0); i < 0x1000; i++ {
+		binary.LittleEndian.PutUint64(nonce, i)
+		ks := string(aead.Seal(nil, nonce, make([]byte, 16), nil)[:16])
+		if seen[ks] {
+			t.Fatalf("counter %d reuses keystream", i)
+		}
+		seen[ks] = true
+	}
+}
+
+// forgeTag flips byte 40 of a sealed 64-byte known plaintext, recovers poly1305 key from
+// first 32 bytes of ciphertext xor plaintext and recomputes the tag
+func forgeTag(ctx, plain []byte) []byte {
+	var polyKey [32]byte
+	for i := range polyKey {
+		polyKey[i] = ctx[i] ^ plain[i]
+	}
+
+	forged := append([]byte{}, ctx...)
+	forged[40] ^= 0x01
+	body := forged[:len(plain)]
+
+	var lens [16]byte
+	binary.LittleEndian.PutUint64(lens[8:], uint64(len(body)))
+	p := poly1305.New(&polyKey)
+	p.Write(body) // 64 bytes, no padding and no AD
+	p.Write(lens[:])
+	p.Sum(forged[len(body):len(body)])
+	return forged
+}
+
+// TestSubkeyForgery known plaintext must not reveal poly1305 key
+func TestSubkeyForgery(t *testing.T) {
+	plain := bytes.Repeat(ptx, 4)
+
+	// NewAEAD keeps rabbitio format, where it works
+	compat, _ := rabaead.NewAEAD(key)
+	if _, err := compat.Open(nil, iv, forgeTag(compat.Seal(nil, iv, plain, nil), plain), nil); err != nil {
+		t.Fatal("forgery must work on rabbitio format, test is broken", err)
+	}
+
+	aead, _ := rabaead.NewSubkeyAEAD(key)
+	ctx := aead.Seal(nil, iv, plain, nil)
+	if _, err := aead.Open(nil, iv, forgeTag(ctx, plain), nil); err != rabaead.ErrAuthMsg {
+		t.Fatal("err auth must returned for forged tag", err)
+	}
+}